@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bearer/go-agent/config"
@@ -35,6 +36,16 @@ type transportMap map[http.RoundTripper]http.RoundTripper
 
 // Agent is the type of the Bearer entry point for your programs.
 type Agent struct {
+	// panics is the number of listener panics, and the next fields the state
+	// of their logging, all accessed atomically: they come first to be 64-bit
+	// aligned.
+	panics uint64
+	// panicsLoggedAt is the time in Unix nanoseconds of the last log of
+	// repeated panics, and panicsUnlogged the number of panics not logged
+	// since.
+	panicsLoggedAt int64
+	panicsUnlogged uint64
+
 	m             sync.Mutex
 	dispatcher    events.Dispatcher
 	SecretKey     string
@@ -77,18 +88,50 @@ func New(secretKey string, opts ...Option) *Agent {
 	a.sender = proxy.NewSender(c.ReportOutstanding, c.ReportEndpoint, Version,
 		c.SecretKey(), c.Environment(),
 		a.DefaultTransport(), a.Logger())
+	a.sender.Workers = c.ReportWorkers
+	a.sender.BatchSize = c.ReportBatchSize
+	a.sender.BatchLinger = c.ReportBatchLinger
+	a.sender.MaxRetries = c.ReportRetries
+	a.sender.RetryBaseDelay = c.ReportRetryBase
+	a.sender.RetryMaxDelay = c.ReportRetryMax
+	a.sender.Exporter = c.ReportExporter
+	if a.sender.Exporter == nil && c.OTLPEndpoint != `` {
+		a.sender.Exporter = proxy.NewOTLPExporter(c.OTLPEndpoint, c.OTLPServiceName, a.DefaultTransport())
+	}
+	a.sender.Compression = c.Compression
+	if c.ReportSpoolDir != `` {
+		spool, err := proxy.NewSpool(c.ReportSpoolDir, c.ReportSpoolMax, proxy.DefaultSpoolSegmentSize)
+		if err != nil {
+			a.LogWarn(`report spool disabled`, map[string]interface{}{`error`: err.Error()})
+		}
+		a.sender.Spool = spool
+	}
 	go a.sender.Start()
 
+	// The dispatcher is only configured once the config is known.
+	a.dispatcher = events.NewDispatcher(
+		events.WithPanicLimit(c.ListenerPanicLimit),
+		events.WithPanicHandler(a.handlePanic),
+		// Never send reports which skipped sanitization or other providers.
+		events.WithFailClosed(interception.TopicReport),
+	)
 	dcrp := interception.DCRProvider{DCRs: a.config.DataCollectionRules()}
 	a.dispatcher.AddProviders(interception.TopicConnect, events.ListenerProviderFunc(a.Provider), dcrp)
-	a.dispatcher.AddProviders(interception.TopicRequest, dcrp)
+	// Sampling applies after the rules which may define its rate, and before
+	// the bodies are captured.
+	a.dispatcher.AddProviders(interception.TopicRequest, dcrp,
+		interception.NewSamplingProvider(c.SampleRate, c.SampleHostRates, a.sender))
 	a.dispatcher.AddProviders(interception.TopicResponse, dcrp)
-	a.dispatcher.AddProviders(interception.TopicBodies, interception.BodyParsingProvider{}, dcrp)
+	a.dispatcher.AddProviders(interception.TopicBodies,
+		interception.BodyParsingProvider{TruncatedBodySize: c.TruncatedBodySize}, dcrp)
 	a.dispatcher.AddProviders(interception.TopicReport,
 		dcrp,
 		interception.SanitizationProvider{
 			SensitiveKeys:    a.config.SensitiveKeys(),
 			SensitiveRegexps: a.config.SensitiveRegexps(),
+			SensitivePaths:   a.config.SensitivePaths(),
+			Detectors:        a.config.SensitiveDetectors(),
+			Redactors:        a.config.Redactors(),
 		},
 		interception.ProxyProvider{Sender: a.sender},
 	)
@@ -131,6 +174,14 @@ func (a *Agent) Decorate(rt http.RoundTripper) http.RoundTripper {
 		Dispatcher: a.dispatcher,
 		Underlying: rt,
 	}
+	if a.config != nil {
+		wrapped.MaximumBodySize = a.config.MaximumBodySize
+		wrapped.PropagateTraceContext = a.config.PropagateTraceContext
+		wrapped.FailOpen = a.config.FailOpen
+	}
+	if a.sender != nil {
+		wrapped.Diagnostics = a.sender
+	}
 
 	a.transports[rt] = wrapped
 	a.transports[wrapped] = wrapped
@@ -148,6 +199,79 @@ func (a *Agent) DecorateClientTransports(clients ...*http.Client) {
 	}
 }
 
+// Middleware wraps a http.Handler with Bearer instrumentation of the API calls
+// it serves, which are reported with the same rules as outbound API calls.
+func (a *Agent) Middleware(h http.Handler) http.Handler {
+	if a.error != nil {
+		return h
+	}
+	wrapped := &interception.Handler{
+		Dispatcher: a.dispatcher,
+		Underlying: h,
+	}
+	if a.config != nil {
+		wrapped.MaximumBodySize = a.config.MaximumBodySize
+		wrapped.PropagateTraceContext = a.config.PropagateTraceContext
+		wrapped.FailOpen = a.config.FailOpen
+	}
+	if a.sender != nil {
+		wrapped.Diagnostics = a.sender
+	}
+	return wrapped
+}
+
+// Instrumentation returns an interception.RoundTripper holding the agent
+// configuration, without an Underlying transport, to instrument the API calls
+// not made over HTTP with its BeginCall method, like the gRPC calls of the
+// grpcagent package. It returns nil if the agent is not active.
+func (a *Agent) Instrumentation() *interception.RoundTripper {
+	if a.error != nil {
+		return nil
+	}
+	rt := &interception.RoundTripper{Dispatcher: a.dispatcher}
+	if a.config != nil {
+		rt.MaximumBodySize = a.config.MaximumBodySize
+		rt.FailOpen = a.config.FailOpen
+	}
+	if a.sender != nil {
+		rt.Diagnostics = a.sender
+	}
+	return rt
+}
+
+// panicLogInterval is the minimum interval between the logs of repeated
+// listener panics.
+const panicLogInterval = time.Minute
+
+// handlePanic counts and logs the panics recovered from listeners, which are
+// agent bugs. Their stack is only logged for the first panic of each provider,
+// and when it gets disabled: afterwards, panics are logged at most once per
+// panicLogInterval, with the number of panics since the previous log.
+func (a *Agent) handlePanic(pe *events.PanicError) {
+	atomic.AddUint64(&a.panics, 1)
+	fields := map[string]interface{}{
+		`topic`: string(pe.Topic),
+		`panic`: fmt.Sprint(pe.Value),
+	}
+	switch {
+	case pe.Disabled:
+		fields[`stack`] = string(pe.Stack)
+		a.LogError(`listener panic: provider disabled`, fields)
+	case pe.Panics <= 1:
+		fields[`stack`] = string(pe.Stack)
+		a.LogError(`listener panic`, fields)
+	default:
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&a.panicsLoggedAt)
+		if now-last < int64(panicLogInterval) || !atomic.CompareAndSwapInt64(&a.panicsLoggedAt, last, now) {
+			atomic.AddUint64(&a.panicsUnlogged, 1)
+			return
+		}
+		fields[`count`] = atomic.SwapUint64(&a.panicsUnlogged, 0) + 1
+		a.LogError(`repeated listener panics`, fields)
+	}
+}
+
 // Error returns any error that has cause the agent to shutdown. If there has
 // been no error then it returns nil
 func (a *Agent) Error() error {
@@ -167,16 +291,31 @@ func (a *Agent) Close() error {
 
 	a.LogTrace("Bearer agent stopping", nil)
 
-	count := uint(0)
+	count := uint64(0)
 	if a.sender != nil {
 		a.sender.Stop()
-		count = a.sender.Counter
+		count = a.sender.Stats().Sent
+		if a.sender.Spool != nil {
+			_ = a.sender.Spool.Close()
+		}
 	}
 
 	a.LogTrace(fmt.Sprintf(`End of Bearer agent operation with %d API calls logged`, count), nil)
 	return nil
 }
 
+// Stats returns a snapshot of the agent reporting activity, suitable for
+// monitoring its health. It is safe for concurrent use, and returns zero Stats
+// if the agent is not reporting.
+func (a *Agent) Stats() proxy.Stats {
+	if a.sender == nil {
+		return proxy.Stats{}
+	}
+	st := a.sender.Stats()
+	st.ListenerPanics = atomic.LoadUint64(&a.panics)
+	return st
+}
+
 // Provider provides the default agent listeners:
 //   - TopicConnect: RFCListener, validating URL under RFC grammars.
 //   - TopicRequest, TopicResponse, TopicBodies: no.
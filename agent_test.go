@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -8,6 +10,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -148,3 +151,81 @@ func TestAgent_Decorate(t *testing.T) {
 		t.Error(`expected round tripper not to be wrapped due to agent error`)
 	}
 }
+
+func TestAgent_Middleware(t *testing.T) {
+	agent := Agent{sender: &proxy.Sender{}}
+	defer agent.Close()
+
+	h := http.NewServeMux()
+	if _, ok := agent.Middleware(h).(*interception.Handler); !ok {
+		t.Error(`expected handler to be wrapped by agent`)
+	}
+
+	agentWithError := Agent{sender: &proxy.Sender{}, error: errors.New(`oops`)}
+	defer agentWithError.Close()
+
+	if agentWithError.Middleware(h) != h {
+		t.Error(`expected handler not to be wrapped due to agent error`)
+	}
+}
+
+func TestAgent_Stats(t *testing.T) {
+	var a Agent
+	if got := a.Stats(); got != (proxy.Stats{}) {
+		t.Errorf("Stats() without sender = %v, want zero Stats", got)
+	}
+
+	a.sender = proxy.NewSender(1, `http://localhost`, Version, ExampleWellFormedInvalidKey, ``, nil, nil)
+	a.sender.Send(proxy.ReportLog{})
+	if got := a.Stats().Queued; got != 1 {
+		t.Errorf("Stats().Queued = %d, want 1", got)
+	}
+
+	a.SetLogger(ioutil.Discard)
+	a.handlePanic(&events.PanicError{Topic: interception.TopicBodies, Value: `oops`})
+	if got := a.Stats().ListenerPanics; got != 1 {
+		t.Errorf("Stats().ListenerPanics = %d, want 1", got)
+	}
+}
+
+func TestAgent_handlePanic(t *testing.T) {
+	var a Agent
+	var logs bytes.Buffer
+	a.SetLogger(&logs)
+	panics := []*events.PanicError{
+		{Topic: interception.TopicBodies, Value: `oops`, Stack: []byte(`stack`), Panics: 1},
+		{Topic: interception.TopicBodies, Value: `oops`, Stack: []byte(`stack`), Panics: 2},
+		{Topic: interception.TopicBodies, Value: `oops`, Stack: []byte(`stack`), Panics: 3},
+		{Topic: interception.TopicBodies, Value: `oops`, Stack: []byte(`stack`), Panics: 4},
+		{Topic: interception.TopicBodies, Value: `oops`, Stack: []byte(`stack`), Panics: 5, Disabled: true},
+	}
+	for _, pe := range panics {
+		a.handlePanic(pe)
+	}
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf(`invalid log line %q: %v`, line, err)
+		}
+		lines = append(lines, fields)
+	}
+	// The first panic and the disabling are logged with their stack, the
+	// repeated panics once per interval.
+	wantMessages := []string{`listener panic`, `repeated listener panics`, `listener panic: provider disabled`}
+	if len(lines) != len(wantMessages) {
+		t.Fatalf(`got %d log lines, want %d: %s`, len(lines), len(wantMessages), logs.String())
+	}
+	for i, want := range wantMessages {
+		if lines[i][`message`] != want {
+			t.Errorf(`log %d message = %v, want %s`, i, lines[i][`message`], want)
+		}
+		if _, hasStack := lines[i][`stack`]; hasStack == (i == 1) {
+			t.Errorf(`log %d has stack %t, want %t`, i, hasStack, i != 1)
+		}
+	}
+	if got := atomic.LoadUint64(&a.panics); got != uint64(len(panics)) {
+		t.Errorf(`counted %d panics, want %d`, got, len(panics))
+	}
+}
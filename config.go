@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/bearer/go-agent/config"
 	"github.com/bearer/go-agent/filters"
 	"github.com/bearer/go-agent/interception"
+	"github.com/bearer/go-agent/proxy"
 )
 
 // Config represents the Agent configuration.
@@ -27,6 +29,9 @@ type Config struct {
 	// Sanitization options.
 	sensitiveRegexes []*regexp.Regexp // Named per Agent spec, although Go uses "regexp".
 	sensitiveKeys    []*regexp.Regexp
+	sensitivePaths   []*interception.Selector
+	detectors        []*interception.Detector
+	redactors        map[string]interception.Redactor
 
 	// Rules.
 	dataCollectionRules []*interception.DataCollectionRule
@@ -38,6 +43,29 @@ type Config struct {
 	fetchInterval     time.Duration
 	ReportEndpoint    string
 	ReportOutstanding uint
+	ReportWorkers     uint
+	ReportBatchSize   uint
+	ReportBatchLinger time.Duration
+	ReportRetries     uint
+	ReportRetryBase   time.Duration
+	ReportRetryMax    time.Duration
+	ReportSpoolDir    string
+	ReportSpoolMax    int64
+	ReportExporter    proxy.Exporter
+	Compression       string
+	OTLPEndpoint      string
+	OTLPServiceName   string
+	TruncatedBodySize int
+	MaximumBodySize   int
+	SampleRate        float64
+	SampleHostRates   map[string]float64
+
+	// Tracing.
+	PropagateTraceContext bool
+
+	// Error handling.
+	FailOpen           bool
+	ListenerPanicLimit uint
 
 	// Internal runtime properties.
 	fetcher *config.Fetcher
@@ -51,6 +79,15 @@ var optionDefaults Option = func(c *Config) error {
 	c.fetchEndpoint = config.DefaultConfigEndpoint
 	c.ReportEndpoint = config.DefaultReportEndpoint
 	c.ReportOutstanding = config.DefaultReportOutstanding
+	c.ReportWorkers = config.DefaultReportWorkers
+	c.ReportBatchSize = config.DefaultReportBatchSize
+	c.ReportBatchLinger = config.DefaultReportBatchLinger
+	c.ReportRetries = config.DefaultReportRetries
+	c.ReportRetryBase = config.DefaultReportRetryBaseDelay
+	c.ReportRetryMax = config.DefaultReportRetryMaxDelay
+	c.ReportSpoolMax = config.DefaultReportSpoolMaxBytes
+	c.SampleRate = config.DefaultSampleRate
+	c.MaximumBodySize = interception.MaximumBodySize
 	c.fetchInterval = config.DefaultFetchInterval
 	c.sensitiveKeys = []*regexp.Regexp{interception.DefaultSensitiveKeys}
 	c.sensitiveRegexes = []*regexp.Regexp{interception.DefaultSensitiveData}
@@ -107,6 +144,7 @@ func WithLogger(logger io.Writer) Option {
 func withRemote(transport http.RoundTripper, version string) Option {
 	return func(c *Config) error {
 		c.fetcher = config.NewFetcher(transport, c.Logger, version, c.fetchEndpoint, c.fetchInterval, c.runtimeEnvironmentType, c.secretKey)
+		c.fetcher.SetCompression(c.Compression)
 		d, err := c.fetcher.Fetch()
 		if err != nil {
 			c.isDisabled = true
@@ -208,6 +246,107 @@ func WithSensitiveRegexps(res []string) Option {
 	}
 }
 
+// WithSensitivePaths is a functional Option configuring the sensitive paths:
+// JSONPath-like selectors of the nodes to redact in structured bodies, like
+// JSON documents and forms, as described for interception.Selector. Unlike
+// sensitive keys, they only match nodes at a given position, so that
+// $.customer.address may be redacted but not $.shipping.address.
+//
+// It will cause an error if any of the selectors is invalid.
+func WithSensitivePaths(paths []string) Option {
+	dups := make(map[string]int, len(paths))
+	var reduced []*interception.Selector
+	for _, path := range paths {
+		dups[path]++
+		if dups[path] > 1 {
+			continue
+		}
+		s, err := interception.ParseSelector(path)
+		if err != nil {
+			return withError(err)
+		}
+		reduced = append(reduced, s)
+	}
+	return func(c *Config) error {
+		c.sensitivePaths = reduced
+		return nil
+	}
+}
+
+// WithSensitiveDetectors is a functional Option enabling built-in detectors of
+// sensitive data by name, like interception.DetectorCard, in addition to the
+// sensitive regexps. Unlike these, detectors validate their matches, like card
+// numbers with a Luhn checksum. To only use detectors, disable the default
+// sensitive regexp with an empty WithSensitiveRegexps.
+//
+// It will cause an error if any of the names is unknown: the available names
+// are returned by interception.DetectorNames.
+func WithSensitiveDetectors(names []string) Option {
+	dups := make(map[string]int, len(names))
+	var reduced []*interception.Detector
+	for _, name := range names {
+		d := interception.DetectorByName(name)
+		if d == nil {
+			return withError(fmt.Errorf("unknown sensitive data detector: %s", name))
+		}
+		dups[name]++
+		if dups[name] > 1 {
+			continue
+		}
+		reduced = append(reduced, d)
+	}
+	return func(c *Config) error {
+		c.detectors = reduced
+		return nil
+	}
+}
+
+// WithRedaction is a functional Option configuring the redaction strategy of a
+// sensitive key, regexp, or path, given by its expression, as passed to
+// WithSensitiveKeys, WithSensitiveRegexps, or WithSensitivePaths, or of a
+// sensitive data detector, given by its name, as passed to
+// WithSensitiveDetectors. By default, the values of sensitive keys and paths,
+// and the matches of sensitive regexps and detectors, are replaced by
+// interception.Filtered.
+//
+// For instance, to correlate the card numbers found by the default sensitive
+// regexp without disclosing them:
+//
+//	WithRedaction(interception.DefaultSensitiveData.String(), interception.HMACRedactor{Key: key})
+func WithRedaction(expression string, redactor interception.Redactor) Option {
+	if expression == "" {
+		return withError(errors.New("empty string may not be used as a redaction expression"))
+	}
+	if redactor == nil {
+		return withError(fmt.Errorf("nil redactor for expression: %s", expression))
+	}
+	switch r := redactor.(type) {
+	case interception.HMACRedactor:
+		if len(r.Key) == 0 {
+			return withError(fmt.Errorf("empty HMAC redaction key for expression: %s", expression))
+		}
+	case *interception.HMACRedactor:
+		if r == nil || len(r.Key) == 0 {
+			return withError(fmt.Errorf("empty HMAC redaction key for expression: %s", expression))
+		}
+	case interception.KeepLastRedactor:
+		if r.N < 0 {
+			return withError(fmt.Errorf("negative kept length %d for expression: %s", r.N, expression))
+		}
+	case *interception.KeepLastRedactor:
+		if r == nil || r.N < 0 {
+			return withError(fmt.Errorf("invalid kept length for expression: %s", expression))
+		}
+	}
+	return func(c *Config) error {
+		if c.redactors == nil {
+			c.redactors = make(map[string]interception.Redactor)
+		}
+		c.redactors[expression] = redactor
+		return nil
+	}
+}
+
 // WithEndpoints is an undocumented functional Option used for development
 // purposes.
 func WithEndpoints(fetchEndpoint string, reportEndpoint string) Option {
@@ -218,6 +357,218 @@ func WithEndpoints(fetchEndpoint string, reportEndpoint string) Option {
 	}
 }
 
+// WithReportWorkers is a functional Option configuring the number of
+// goroutines transmitting reports to Bearer concurrently.
+func WithReportWorkers(workers uint) Option {
+	if workers == 0 {
+		return withError(errors.New("the number of report workers must be positive"))
+	}
+	return func(c *Config) error {
+		c.ReportWorkers = workers
+		return nil
+	}
+}
+
+// WithReportBatching is a functional Option configuring the batching of
+// reports sent to Bearer.
+//
+// Reports are transmitted once size of them are pending, or once the oldest
+// pending report has waited for linger, whichever comes first. A size of 0 or 1,
+// or a linger of 0, disables batching.
+func WithReportBatching(size uint, linger time.Duration) Option {
+	if linger < 0 {
+		return withError(fmt.Errorf("report batching linger may not be negative: %v", linger))
+	}
+	return func(c *Config) error {
+		c.ReportBatchSize = size
+		c.ReportBatchLinger = linger
+		return nil
+	}
+}
+
+// WithReportRetries is a functional Option configuring the retries of failed
+// report transmissions.
+//
+// Connection errors and HTTP 408, 429 and 5xx responses are retried up to
+// retries times, waiting baseDelay before the first retry, then doubling the
+// delay for each further retry, up to maxDelay. A retries value of 0 disables
+// retries.
+func WithReportRetries(retries uint, baseDelay time.Duration, maxDelay time.Duration) Option {
+	if baseDelay < 0 || maxDelay < 0 {
+		return withError(fmt.Errorf("report retry delays may not be negative: %v, %v", baseDelay, maxDelay))
+	}
+	return func(c *Config) error {
+		c.ReportRetries = retries
+		c.ReportRetryBase = baseDelay
+		c.ReportRetryMax = maxDelay
+		return nil
+	}
+}
+
+// WithReportSpool is a functional Option enabling the on-disk spool of reports
+// which could not be transmitted, in the dir directory.
+//
+// Reports are spooled instead of being lost when too many reports are in
+// flight or the Bearer platform cannot be reached, and transmitted later, even
+// after a restart of the application. Once the spool exceeds maxBytes, the
+// oldest reports are dropped. A maxBytes of 0 means the spool is not capped.
+func WithReportSpool(dir string, maxBytes int64) Option {
+	if dir == `` {
+		return withError(errors.New("the report spool directory may not be empty"))
+	}
+	if maxBytes < 0 {
+		return withError(fmt.Errorf("the report spool size may not be negative: %d", maxBytes))
+	}
+	return func(c *Config) error {
+		c.ReportSpoolDir = dir
+		c.ReportSpoolMax = maxBytes
+		return nil
+	}
+}
+
+// WithReportExporter is a functional Option replacing the transmission of
+// reports to the Bearer platform by a custom proxy.Exporter, like a
+// proxy.WriterExporter to keep reports local during development.
+func WithReportExporter(exporter proxy.Exporter) Option {
+	if exporter == nil {
+		return withError(errors.New("the report exporter may not be nil"))
+	}
+	return func(c *Config) error {
+		c.ReportExporter = exporter
+		return nil
+	}
+}
+
+// WithOTLPExporter is a functional Option replacing the transmission of
+// reports to the Bearer platform by the export of API calls as spans to an
+// OpenTelemetry collector at endpoint, using OTLP/HTTP with JSON encoding.
+//
+// The endpoint is the full URL of the collector traces endpoint, usually
+// ending with proxy.OTLPTracesPath. The serviceName is the service.name
+// resource attribute of the spans, defaulting to proxy.DefaultOTLPServiceName.
+// It is ignored if WithReportExporter is also used.
+func WithOTLPExporter(endpoint string, serviceName string) Option {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == `` || u.Host == `` {
+		return withError(fmt.Errorf("invalid OTLP endpoint: %s", endpoint))
+	}
+	return func(c *Config) error {
+		c.OTLPEndpoint = endpoint
+		c.OTLPServiceName = serviceName
+		return nil
+	}
+}
+
+// WithCompression is a functional Option configuring the Content-Encoding
+// applied to the payloads sent to the Bearer platform, for both reports and
+// configuration requests: one of proxy.CompressionNone, proxy.CompressionGzip,
+// or proxy.CompressionZstd.
+func WithCompression(encoding string) Option {
+	if !proxy.IsValidCompression(encoding) {
+		return withError(fmt.Errorf("unsupported compression: %s", encoding))
+	}
+	return func(c *Config) error {
+		c.Compression = encoding
+		return nil
+	}
+}
+
+// WithTruncatedBodies is a functional Option enabling the capture of the
+// first size bytes of JSON and text bodies too long to be captured whole,
+// instead of omitting them. This also applies to the bodies the application
+// did not read whole, of which only the part it read is captured. Truncated
+// JSON bodies are decoded on a best-effort basis, so they can be sanitized and
+// shape-hashed like complete bodies.
+func WithTruncatedBodies(size int) Option {
+	if size <= 0 {
+		return withError(fmt.Errorf("truncated body size must be positive: %d", size))
+	}
+	return func(c *Config) error {
+		c.TruncatedBodySize = size
+		return nil
+	}
+}
+
+// WithMaximumBodySize is a functional Option setting the largest size of
+// request and response bodies captured whole, instead of the default
+// interception.MaximumBodySize. Larger bodies are omitted or truncated.
+//
+// Data collection rules may also override the size for the API calls
+// triggering them, with their interception.MaximumBodySizeParam parameter.
+func WithMaximumBodySize(size int) Option {
+	if size <= 0 {
+		return withError(fmt.Errorf("maximum body size must be positive: %d", size))
+	}
+	return func(c *Config) error {
+		c.MaximumBodySize = size
+		return nil
+	}
+}
+
+// WithSampling is a functional Option configuring the deterministic sampling
+// of reported API calls: only a fraction rate of them is reported, the other
+// ones being only counted, without capturing or parsing their bodies. The
+// hostRates map overrides rate for specific hosts. All rates must be in the
+// [0, 1] interval.
+//
+// Data collection rules triggered up to the request stage may also override
+// the rate of the API calls, with their interception.SampleRateParam parameter.
+func WithSampling(rate float64, hostRates map[string]float64) Option {
+	if !interception.IsValidSampleRate(rate) {
+		return withError(fmt.Errorf("sample rate must be in [0, 1]: %v", rate))
+	}
+	for host, hostRate := range hostRates {
+		if !interception.IsValidSampleRate(hostRate) {
+			return withError(fmt.Errorf("sample rate for host %s must be in [0, 1]: %v", host, hostRate))
+		}
+	}
+	return func(c *Config) error {
+		c.SampleRate = rate
+		c.SampleHostRates = hostRates
+		return nil
+	}
+}
+
+// WithTraceContextPropagation is a functional Option enabling the propagation
+// of W3C Trace Context headers: outbound requests not already carrying them
+// continue the trace of the request context, or start a new one, and served
+// requests continue the trace of their caller. The trace and span IDs are
+// included in the reports, to join them with distributed traces.
+func WithTraceContextPropagation(enabled bool) Option {
+	return func(c *Config) error {
+		c.PropagateTraceContext = enabled
+		return nil
+	}
+}
+
+// WithFailOpen is a functional Option controlling the handling of internal
+// agent errors, like a listener failing to decode a body. By default, they are
+// returned to the application as the error of the call. In fail-open mode,
+// they are reported separately as diagnostics, and instrumented calls always
+// return the response and error of the underlying transport.
+func WithFailOpen(enabled bool) Option {
+	return func(c *Config) error {
+		c.FailOpen = enabled
+		return nil
+	}
+}
+
+// WithListenerPanicLimit is a functional Option disabling the agent listener
+// providers, like data collection rules or sanitization, once their listeners
+// panicked limit times. Panics are always recovered, counted in the agent
+// Stats, and logged, so that they do not crash the application. A zero limit,
+// which is the default, never disables providers.
+//
+// Disabling a provider of the report stage, like sanitization, fails closed:
+// the calls are no longer reported at all, so that no unsanitized data is
+// ever transmitted.
+func WithListenerPanicLimit(limit uint) Option {
+	return func(c *Config) error {
+		c.ListenerPanicLimit = limit
+		return nil
+	}
+}
+
 // DisableRemote stops the goroutine updating the Agent configuration periodically.
 func (c *Config) DisableRemote() {
 	if c.fetcher == nil {
@@ -247,6 +598,21 @@ func (c *Config) SensitiveKeys() []*regexp.Regexp {
 	return c.sensitiveKeys
 }
 
+// Redactors is a getter for redactors.
+func (c *Config) Redactors() map[string]interception.Redactor {
+	return c.redactors
+}
+
+// SensitivePaths is a getter for sensitivePaths.
+func (c *Config) SensitivePaths() []*interception.Selector {
+	return c.sensitivePaths
+}
+
+// SensitiveDetectors is a getter for detectors.
+func (c *Config) SensitiveDetectors() []*interception.Detector {
+	return c.detectors
+}
+
 // SensitiveRegexps is a getter for sensitiveRegexps.
 func (c *Config) SensitiveRegexps() []*regexp.Regexp {
 	return c.sensitiveRegexes
@@ -30,6 +30,37 @@ const (
 	// exceeded, records are no longer sent to Bearer to avoid saturating the
 	// client.
 	DefaultReportOutstanding = 1000
+
+	// DefaultSampleRate is the default rate at which API calls are reported.
+	DefaultSampleRate = 1.0
+
+	// DefaultReportWorkers is the default number of goroutines transmitting
+	// reports concurrently.
+	DefaultReportWorkers = 4
+
+	// DefaultReportBatchSize is the default maximum number of ReportLog
+	// elements transmitted to Bearer in a single LogReport.
+	DefaultReportBatchSize = 100
+
+	// DefaultReportBatchLinger is the default maximum duration a ReportLog
+	// element will wait for its batch to fill up before being transmitted.
+	DefaultReportBatchLinger = 1 * time.Second
+
+	// DefaultReportRetries is the default maximum number of retries of a
+	// report transmission after a retryable failure.
+	DefaultReportRetries = 3
+
+	// DefaultReportRetryBaseDelay is the default delay before the first retry
+	// of a report transmission. It doubles on each further retry.
+	DefaultReportRetryBaseDelay = 500 * time.Millisecond
+
+	// DefaultReportRetryMaxDelay is the default maximum delay between retries
+	// of a report transmission.
+	DefaultReportRetryMaxDelay = 5 * time.Second
+
+	// DefaultReportSpoolMaxBytes is the default maximum size of the on-disk
+	// spool of reports which could not be transmitted.
+	DefaultReportSpoolMaxBytes = 64 << 20
 )
 
 // TraceLogging is set in init() and enabled the default logger for Trace level.
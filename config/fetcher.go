@@ -179,6 +179,7 @@ func (d *Description) ResolveDCRs(filterMap filters.FilterMap) ([]*interception.
 
 // Fetcher describes the data used to perform the background configuration refresh.
 type Fetcher struct {
+	compression     string
 	done            chan bool
 	endpoint        string
 	environmentType string
@@ -203,6 +204,13 @@ func NewFetcher(transport http.RoundTripper, logger *zerolog.Logger, version str
 	}
 }
 
+// SetCompression sets the Content-Encoding applied to the configuration
+// requests, one of the proxy.Compression* values, returning the Fetcher.
+func (f *Fetcher) SetCompression(encoding string) *Fetcher {
+	f.compression = encoding
+	return f
+}
+
 // Fetch fetches a fresh configuration from the Bearer platform and assigns it
 // to the current config. As per Agent spec, all config fetch errors are logged
 // and ignored.
@@ -210,8 +218,13 @@ func (f *Fetcher) Fetch() (*Description, error) {
 	report := &bytes.Buffer{}
 	// Cannot fail, the only possible error coming from os.Hostname() is handled.
 	_ = json.NewEncoder(report).Encode(proxy.MakeConfigReport(f.version, f.environmentType, ``))
+	payload, err := proxy.Compress(f.compression, report.Bytes())
+	if err != nil {
+		f.logger.Warn().Msgf("compressing Bearer remote config request: %v", err)
+		return nil, err
+	}
 
-	req, err := http.NewRequest(http.MethodPost, f.endpoint, report)
+	req, err := http.NewRequest(http.MethodPost, f.endpoint, bytes.NewReader(payload))
 	if err != nil {
 		f.logger.Warn().Msgf("building Bearer remote config request: %v", err)
 		return nil, err
@@ -219,6 +232,9 @@ func (f *Fetcher) Fetch() (*Description, error) {
 	req.Header.Add(proxy.AcceptHeader, "application/json")
 	req.Header.Add(proxy.AuthorizationHeader, f.secretKey)
 	req.Header.Set(proxy.ContentTypeHeader, proxy.FullContentTypeJSON)
+	if f.compression != proxy.CompressionNone {
+		req.Header.Set(proxy.ContentEncodingHeader, f.compression)
+	}
 
 	client := http.Client{Transport: f.transport}
 	res, err := client.Do(req)
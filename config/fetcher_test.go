@@ -1,6 +1,8 @@
 package config
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -222,3 +224,30 @@ func TestFetcher_Fetch(t *testing.T) {
 		})
 	}
 }
+
+func TestFetcher_FetchCompressed(t *testing.T) {
+	var gotEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		gotEncoding = request.Header.Get(proxy.ContentEncodingHeader)
+		r, err := gzip.NewReader(request.Body)
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r).Decode(&proxy.LogReport{}); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = writer.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	z := zerolog.Nop()
+	f := NewFetcher(nil, &z, `0.0.1`, ts.URL, time.Hour, ``, ``).SetCompression(proxy.CompressionGzip)
+	if _, err := f.Fetch(); err != nil {
+		t.Fatalf(`Fetch() error = %v`, err)
+	}
+	if gotEncoding != proxy.CompressionGzip {
+		t.Errorf(`got Content-Encoding %s, want %s`, gotEncoding, proxy.CompressionGzip)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/bearer/go-agent"
+	"github.com/bearer/go-agent/interception"
+	"github.com/bearer/go-agent/proxy"
 )
 
 // TODO improve tests to avoid calling the config server.
@@ -155,6 +158,110 @@ func TestConfig_WithSensitiveRegexes(t *testing.T) {
 	}
 }
 
+func TestConfig_WithSensitivePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+		wantFail bool
+	}{
+		{"happy", []string{"$.customer.address", "$.items[*].card"}, []string{"$.customer.address", "$.items[*].card"}, false},
+		{"duplicates", []string{"$..password", "$..password"}, []string{"$..password"}, false},
+		{"none", nil, nil, false},
+		{"invalid", []string{"customer.address"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithSensitivePaths(tt.paths),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with paths: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			var actual []string
+			for _, s := range c.SensitivePaths() {
+				actual = append(actual, s.String())
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("SensitivePaths() = %v, want %v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfig_WithSensitiveDetectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+		wantFail bool
+	}{
+		{"happy", []string{interception.DetectorCard, interception.DetectorJWT}, []string{interception.DetectorCard, interception.DetectorJWT}, false},
+		{"duplicates", []string{interception.DetectorIBAN, interception.DetectorIBAN}, []string{interception.DetectorIBAN}, false},
+		{"none", nil, nil, false},
+		{"unknown", []string{interception.DetectorCard, "passport"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithSensitiveDetectors(tt.names),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with detectors: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			var actual []string
+			for _, d := range c.SensitiveDetectors() {
+				actual = append(actual, d.Name)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("SensitiveDetectors() = %v, want %v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfig_WithRedaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		redactor   interception.Redactor
+		wantFail   bool
+	}{
+		{"happy", "one", interception.KeepLastRedactor{N: 4}, false},
+		{"happy hmac", "one", interception.HMACRedactor{Key: []byte("key")}, false},
+		{"empty expression", "", interception.MaskRedactor{}, true},
+		{"nil redactor", "one", nil, true},
+		{"empty hmac key", "one", interception.HMACRedactor{}, true},
+		{"happy hmac pointer", "one", &interception.HMACRedactor{Key: []byte("key")}, false},
+		{"empty hmac key pointer", "one", &interception.HMACRedactor{}, true},
+		{"nil hmac pointer", "one", (*interception.HMACRedactor)(nil), true},
+		{"negative keep last", "one", interception.KeepLastRedactor{N: -1}, true},
+		{"negative keep last pointer", "one", &interception.KeepLastRedactor{N: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithRedaction(tt.expression, tt.redactor),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with redaction: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			if got := c.Redactors()[tt.expression]; !reflect.DeepEqual(got, tt.redactor) {
+				t.Errorf("Redactors()[%s] = %v, want %v", tt.expression, got, tt.redactor)
+			}
+		})
+	}
+}
+
 func TestConfig_WithEndpoints(t *testing.T) {
 	const expected = "http://report.example.com/data"
 	c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
@@ -168,3 +275,269 @@ func TestConfig_WithEndpoints(t *testing.T) {
 		t.Errorf("incorrect report endpoint: expected %s, got %s", expected, actual)
 	}
 }
+
+func TestConfig_WithReportWorkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		workers  uint
+		wantFail bool
+	}{
+		{`happy`, 8, false},
+		{`sad no worker`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithReportWorkers(tt.workers),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with report workers: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			if c.ReportWorkers != tt.workers {
+				t.Errorf("incorrect report workers: expected %d, got %d", tt.workers, c.ReportWorkers)
+			}
+		})
+	}
+}
+
+func TestConfig_WithSampling(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		hostRates map[string]float64
+		wantFail  bool
+	}{
+		{`happy`, 0.5, map[string]float64{`example.com`: 0.1}, false},
+		{`sad rate`, 1.5, nil, true},
+		{`sad host rate`, 0.5, map[string]float64{`example.com`: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithSampling(tt.rate, tt.hostRates),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with sampling: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			if c.SampleRate != tt.rate || !reflect.DeepEqual(c.SampleHostRates, tt.hostRates) {
+				t.Errorf("incorrect sampling: expected %v/%v, got %v/%v",
+					tt.rate, tt.hostRates, c.SampleRate, c.SampleHostRates)
+			}
+		})
+	}
+}
+
+func TestConfig_WithOTLPExporter(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantFail bool
+	}{
+		{`happy`, `http://localhost:4318/v1/traces`, false},
+		{`sad relative`, `/v1/traces`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithOTLPExporter(tt.endpoint, `service`),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with OTLP exporter: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			if c.OTLPEndpoint != tt.endpoint || c.OTLPServiceName != `service` {
+				t.Errorf("incorrect OTLP exporter: expected %s/service, got %s/%s",
+					tt.endpoint, c.OTLPEndpoint, c.OTLPServiceName)
+			}
+		})
+	}
+}
+
+func TestConfig_WithTruncatedBodies(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		wantFail bool
+	}{
+		{`happy`, 4096, false},
+		{`sad zero`, 0, true},
+		{`beyond default maximum`, interception.MaximumBodySize + 1, false},
+		{`sad negative`, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithTruncatedBodies(tt.size),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with truncated bodies: %v", err)
+			}
+			if !tt.wantFail && c.TruncatedBodySize != tt.size {
+				t.Errorf("incorrect truncated body size: expected %d, got %d", tt.size, c.TruncatedBodySize)
+			}
+		})
+	}
+}
+
+func TestConfig_WithMaximumBodySize(t *testing.T) {
+	c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version)
+	if err != nil {
+		t.Fatalf("failed building default config: %v", err)
+	}
+	if c.MaximumBodySize != interception.MaximumBodySize {
+		t.Errorf("incorrect default maximum body size: expected %d, got %d",
+			interception.MaximumBodySize, c.MaximumBodySize)
+	}
+
+	tests := []struct {
+		name     string
+		size     int
+		wantFail bool
+	}{
+		{`happy`, 4 << 20, false},
+		{`sad zero`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithMaximumBodySize(tt.size),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with maximum body size: %v", err)
+			}
+			if !tt.wantFail && c.MaximumBodySize != tt.size {
+				t.Errorf("incorrect maximum body size: expected %d, got %d", tt.size, c.MaximumBodySize)
+			}
+		})
+	}
+}
+
+func TestConfig_WithTraceContextPropagation(t *testing.T) {
+	c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+		agent.WithTraceContextPropagation(true),
+	)
+	if err != nil {
+		t.Fatalf("failed building config with trace context propagation: %v", err)
+	}
+	if !c.PropagateTraceContext {
+		t.Errorf("trace context propagation not enabled")
+	}
+}
+
+func TestConfig_WithFailOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []agent.Option
+		want bool
+	}{
+		{`default`, nil, false},
+		{`enabled`, []agent.Option{agent.WithFailOpen(true)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version, tt.opts...)
+			if err != nil {
+				t.Fatalf("failed building config: %v", err)
+			}
+			if c.FailOpen != tt.want {
+				t.Errorf("FailOpen = %t, want %t", c.FailOpen, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_WithListenerPanicLimit(t *testing.T) {
+	c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+		agent.WithListenerPanicLimit(3),
+	)
+	if err != nil {
+		t.Fatalf("failed building config with listener panic limit: %v", err)
+	}
+	if c.ListenerPanicLimit != 3 {
+		t.Errorf("ListenerPanicLimit = %d, want 3", c.ListenerPanicLimit)
+	}
+}
+
+func TestConfig_WithReportBatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     uint
+		linger   time.Duration
+		wantFail bool
+	}{
+		{`happy`, 50, time.Second, false},
+		{`unbatched`, 0, 0, false},
+		{`sad negative linger`, 50, -time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithReportBatching(tt.size, tt.linger),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with report batching: %v", err)
+			}
+			if tt.wantFail {
+				return
+			}
+			if c.ReportBatchSize != tt.size || c.ReportBatchLinger != tt.linger {
+				t.Errorf("incorrect report batching: expected %d/%v, got %d/%v",
+					tt.size, tt.linger, c.ReportBatchSize, c.ReportBatchLinger)
+			}
+		})
+	}
+}
+
+func TestConfig_WithReportExporter(t *testing.T) {
+	expected := proxy.NewMemoryExporter()
+	c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+		agent.WithReportExporter(expected),
+	)
+	if err != nil {
+		t.Fatalf("failed building config with report exporter: %v", err)
+	}
+	if c.ReportExporter != expected {
+		t.Errorf("incorrect report exporter: expected %v, got %v", expected, c.ReportExporter)
+	}
+
+	_, err = agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+		agent.WithReportExporter(nil),
+	)
+	if err == nil {
+		t.Errorf("built config with nil report exporter")
+	}
+}
+
+func TestConfig_WithCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		wantFail bool
+	}{
+		{`none`, proxy.CompressionNone, false},
+		{`gzip`, proxy.CompressionGzip, false},
+		{`zstd`, proxy.CompressionZstd, false},
+		{`sad unsupported`, `br`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := agent.NewConfig(agent.ExampleWellFormedInvalidKey, nil, agent.Version,
+				agent.WithCompression(tt.encoding),
+			)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("unexpected error building config with compression: %v", err)
+			}
+			if !tt.wantFail && c.Compression != tt.encoding {
+				t.Errorf("incorrect compression: expected %s, got %s", tt.encoding, c.Compression)
+			}
+		})
+	}
+}
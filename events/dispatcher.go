@@ -7,7 +7,9 @@ package events
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
 // Error provides the ability to define constant errors, preventing global modification.
@@ -25,6 +27,42 @@ func (e Error) Error() string {
 // the Emitter.
 const DispatchStopRequest = Error("stop dispatch")
 
+// ProviderDisabled is the error returned by Dispatch for Events on fail-closed
+// topics, once one of their ListenerProviders was disabled by panics.
+const ProviderDisabled = Error("listener provider disabled")
+
+// PanicError is the error returned by Dispatch when a Listener, or the
+// ListenerProvider returning it, panicked. The panic is recovered, so that
+// the Emitter is not crashed by a failing Listener.
+type PanicError struct {
+	// Topic is the Topic of the dispatched Event.
+	Topic Topic
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine when it panicked.
+	Stack []byte
+
+	// Disabled is true if the panic caused the ListenerProvider to be disabled.
+	Disabled bool
+
+	// Panics is the number of panics of the ListenerProvider so far, including
+	// this one.
+	Panics uint
+}
+
+// Error implements the error interface.
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("listener panic on %s: %v", pe.Topic, pe.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (pe *PanicError) Unwrap() error {
+	err, _ := pe.Value.(error)
+	return err
+}
+
 // Dispatcher is the interface for event dispatchers. It is inspired by the
 // PSR-14 EventDispatcherInterface.
 //
@@ -38,6 +76,9 @@ const DispatchStopRequest = Error("stop dispatch")
 //   - or an error occurred,
 //   - or listener requested propagation to stop,
 //   - or the context was canceled.
+//
+// A panic in a Listener or ListenerProvider is recovered, and ends the dispatch
+// loop like an error, as a *PanicError.
 type Dispatcher interface {
 	// Dispatch provides all relevant listeners with an event to process.
 	// It returns the same Event object it was passed after it is done invoking
@@ -82,12 +123,96 @@ func (lpf ListenerProviderFunc) Listeners(e Event) []Listener {
 	return lpf(e)
 }
 
-type providersMap map[Topic][]ListenerProvider
+// providerState is a ListenerProvider with the count of the panics it caused.
+type providerState struct {
+	ListenerProvider
+	panics   uint32
+	disabled int32
+}
+
+type providersMap map[Topic][]*providerState
 
 // dispatcher is the default implementation of the Dispatcher interface.
 type dispatcher struct {
 	m         sync.Mutex
 	providers providersMap
+
+	// panicLimit is the number of panics after which a ListenerProvider is
+	// disabled. Zero means never.
+	panicLimit uint32
+
+	// onPanic, if not nil, is called with every recovered panic.
+	onPanic func(*PanicError)
+
+	// failClosed are the topics on which a disabled provider fails the
+	// dispatch instead of being skipped.
+	failClosed map[Topic]bool
+}
+
+// DispatcherOption configures the Dispatcher returned by NewDispatcher.
+type DispatcherOption func(*dispatcher)
+
+// WithPanicLimit disables the ListenerProviders whose listeners panicked limit
+// times: they are no longer used afterwards. A zero limit never disables them.
+func WithPanicLimit(limit uint) DispatcherOption {
+	return func(d *dispatcher) {
+		d.panicLimit = uint32(limit)
+	}
+}
+
+// WithFailClosed makes Dispatch fail with ProviderDisabled for Events on the
+// given topics once any of their ListenerProviders is disabled, instead of
+// skipping it and calling the next ones. Use it on topics where the later
+// providers rely on the work of the earlier ones, like sanitization before
+// transmission.
+func WithFailClosed(topics ...Topic) DispatcherOption {
+	return func(d *dispatcher) {
+		if d.failClosed == nil {
+			d.failClosed = make(map[Topic]bool, len(topics))
+		}
+		for _, topic := range topics {
+			d.failClosed[topic] = true
+		}
+	}
+}
+
+// WithPanicHandler sets a function called with every panic recovered from a
+// Listener or ListenerProvider, to count or log them. It must not panic.
+func WithPanicHandler(handler func(*PanicError)) DispatcherOption {
+	return func(d *dispatcher) {
+		d.onPanic = handler
+	}
+}
+
+// recoverPanic converts a panic of a Listener or ListenerProvider of ps into a
+// PanicError stored in err.
+func (d *dispatcher) recoverPanic(topic Topic, ps *providerState, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	panics := atomic.AddUint32(&ps.panics, 1)
+	pe := &PanicError{Topic: topic, Value: value, Stack: debug.Stack(), Panics: uint(panics)}
+	if d.panicLimit > 0 && panics >= d.panicLimit {
+		pe.Disabled = atomic.CompareAndSwapInt32(&ps.disabled, 0, 1)
+	}
+	if d.onPanic != nil {
+		d.onPanic(pe)
+	}
+	*err = pe
+}
+
+// listeners returns the Listeners of a provider for an Event, or the
+// PanicError if the provider panicked.
+func (d *dispatcher) listeners(ps *providerState, e Event) (l []Listener, err error) {
+	defer d.recoverPanic(e.Topic(), ps, &err)
+	return ps.Listeners(e), nil
+}
+
+// call invokes a Listener of a provider, converting its panics to PanicError.
+func (d *dispatcher) call(ctx context.Context, ps *providerState, listener Listener, e Event) (err error) {
+	defer d.recoverPanic(e.Topic(), ps, &err)
+	return listener(ctx, e)
 }
 
 func (d *dispatcher) Dispatch(ctx context.Context, e Event) (Event, error) {
@@ -114,12 +239,22 @@ func (d *dispatcher) Dispatch(ctx context.Context, e Event) (Event, error) {
 	defer cancel()
 
 	for _, provider := range providers {
-		for i, listener := range provider.Listeners(e) {
+		if atomic.LoadInt32(&provider.disabled) != 0 {
+			if d.failClosed[topic] {
+				return e, ProviderDisabled
+			}
+			continue
+		}
+		listeners, err := d.listeners(provider, e)
+		if err != nil {
+			return e, err
+		}
+		for i, listener := range listeners {
 			var ctxErr error
 			if ctxErr = dispatcherCtx.Err(); ctxErr != nil {
 				return e, contextualize(i, "before", ctxErr)
 			}
-			listenerErr := listener(dispatcherCtx, e)
+			listenerErr := d.call(dispatcherCtx, provider, listener, e)
 			if ctxErr = dispatcherCtx.Err(); ctxErr != nil {
 				ctxErr = contextualize(i, "after", ctxErr)
 			}
@@ -157,7 +292,9 @@ func (d *dispatcher) AddProviders(topic Topic, providers ...ListenerProvider) Di
 	if d.providers == nil {
 		d.providers = make(providersMap)
 	}
-	d.providers[topic] = append(d.providers[topic], providers...)
+	for _, provider := range providers {
+		d.providers[topic] = append(d.providers[topic], &providerState{ListenerProvider: provider})
+	}
 	return d
 }
 
@@ -180,9 +317,13 @@ func (d *dispatcher) Reset(topics ...Topic) Dispatcher {
 // NewDispatcher returns a basic Dispatcher implementation.
 //
 // Client code may use this constructor or create their own Dispatcher implementations.
-func NewDispatcher() Dispatcher {
-	return &dispatcher{
+func NewDispatcher(opts ...DispatcherOption) Dispatcher {
+	d := &dispatcher{
 		providers: make(providersMap),
 	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
@@ -429,3 +429,127 @@ func Test_dispatcher_Reset(t *testing.T) {
 		})
 	}
 }
+
+func Test_dispatcher_DispatchPanic(t *testing.T) {
+	const topic = "topic"
+	failure := errors.New("listener bug")
+	tests := []struct {
+		name         string
+		limit        uint
+		wantCalls    int
+		wantDisabled int
+	}{
+		{"never disabled", 0, 3, 0},
+		{"disabled after 2 panics", 2, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var handled []*events.PanicError
+			panicking := events.ListenerProviderFunc(func(events.Event) []events.Listener {
+				return []events.Listener{
+					func(context.Context, events.Event) error {
+						calls++
+						panic(failure)
+					},
+				}
+			})
+			d := events.NewDispatcher(
+				events.WithPanicLimit(tt.limit),
+				events.WithPanicHandler(func(pe *events.PanicError) {
+					handled = append(handled, pe)
+				}),
+			).AddProviders(topic, panicking)
+
+			for i := 0; i < 3; i++ {
+				_, err := d.Dispatch(context.Background(), events.NewEvent(topic))
+				if i >= tt.wantCalls {
+					if err != nil {
+						t.Errorf("dispatch %d to a disabled provider returned %v", i, err)
+					}
+					continue
+				}
+				var pe *events.PanicError
+				if !errors.As(err, &pe) || !errors.Is(err, failure) {
+					t.Fatalf("dispatch %d returned %v, want a PanicError", i, err)
+				}
+				if !strings.Contains(string(pe.Stack), "Test_dispatcher_DispatchPanic") {
+					t.Errorf("PanicError stack does not contain the panicking listener:\n%s", pe.Stack)
+				}
+			}
+			if calls != tt.wantCalls || len(handled) != tt.wantCalls {
+				t.Errorf("got %d calls and %d handled panics, want %d", calls, len(handled), tt.wantCalls)
+			}
+			disabled := 0
+			for i, pe := range handled {
+				if pe.Disabled {
+					disabled++
+				}
+				if pe.Panics != uint(i+1) {
+					t.Errorf("panic %d counted as %d", i+1, pe.Panics)
+				}
+			}
+			if disabled != tt.wantDisabled {
+				t.Errorf("got %d disabling panics, want %d", disabled, tt.wantDisabled)
+			}
+		})
+	}
+}
+
+func Test_dispatcher_DispatchFailClosed(t *testing.T) {
+	const topic = "topic"
+	called := 0
+	d := events.NewDispatcher(
+		events.WithPanicLimit(1),
+		events.WithFailClosed(topic),
+	).AddProviders(topic,
+		events.ListenerProviderFunc(func(events.Event) []events.Listener {
+			return []events.Listener{func(context.Context, events.Event) error {
+				panic("listener bug")
+			}}
+		}),
+		events.ListenerProviderFunc(func(events.Event) []events.Listener {
+			return []events.Listener{func(context.Context, events.Event) error {
+				called++
+				return nil
+			}}
+		}),
+	)
+	for i := 0; i < 3; i++ {
+		_, err := d.Dispatch(context.Background(), events.NewEvent(topic))
+		var pe *events.PanicError
+		switch {
+		case i == 0 && !errors.As(err, &pe):
+			t.Fatalf("dispatch %d returned %v, want a PanicError", i, err)
+		case i > 0 && err != events.ProviderDisabled:
+			t.Fatalf("dispatch %d returned %v, want ProviderDisabled", i, err)
+		}
+	}
+	if called != 0 {
+		t.Errorf("listeners after the disabled provider were called %d times", called)
+	}
+}
+
+func Test_dispatcher_DispatchProviderPanic(t *testing.T) {
+	const topic = "topic"
+	called := false
+	d := events.NewDispatcher().AddProviders(topic,
+		events.ListenerProviderFunc(func(events.Event) []events.Listener {
+			panic("provider bug")
+		}),
+		events.ListenerProviderFunc(func(events.Event) []events.Listener {
+			return []events.Listener{func(context.Context, events.Event) error {
+				called = true
+				return nil
+			}}
+		}),
+	)
+	_, err := d.Dispatch(context.Background(), events.NewEvent(topic))
+	var pe *events.PanicError
+	if !errors.As(err, &pe) || pe.Value != "provider bug" || pe.Topic != topic {
+		t.Fatalf("returned %v, want a PanicError", err)
+	}
+	if called {
+		t.Error("listeners after the panicking provider were called")
+	}
+}
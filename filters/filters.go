@@ -88,6 +88,8 @@ var (
 	ResponseHeadersFilterType FilterType = filterType{"ResponseHeadersFilter", responseHeadersFilterFromDescription, false, true}
 	// StatusCodeFilterType describes StatusCodeFilter.
 	StatusCodeFilterType FilterType = filterType{"StatusCodeFilter", statusCodeFilterFromDescription, false, true}
+	// TLSFilterType describes TLSFilter.
+	TLSFilterType FilterType = filterType{"TLSFilter", tlsFilterFromDescription, false, true}
 
 	//RequestBodiesFilterType  FilterType = filterType{"RequestBodiesFilter", requestBodiesFilterFromDescription, true, false}
 	//ResponseBodiesFilterType FilterType = filterType{"ResponseBodiesFilter", responseBodiesFilterFromDescription, false, true}
@@ -120,6 +122,8 @@ func FilterTypeByName(name string) FilterType {
 		return ResponseHeadersFilterType
 	case StatusCodeFilterType.Name():
 		return StatusCodeFilterType
+	case TLSFilterType.Name():
+		return TLSFilterType
 	case ConnectionErrorFilterType.Name():
 		return ConnectionErrorFilterType
 	case YesInternalFilter.Name():
@@ -162,6 +166,10 @@ type FilterDescription struct {
 	// Range is set on filters using filters.RangeMatcher like filters.StatusCodeFilter.
 	Range RangeMatcherDescription
 
+	// TLSAttribute is set on filters.TLSFilter to select the connection detail
+	// to match, like filters.TLSExpiresInDays.
+	TLSAttribute string
+
 	// StageType is one of the 4 API call stages.
 	StageType string
 
@@ -180,6 +188,9 @@ func (d FilterDescription) String() string {
 	if d.Value != `` {
 		b.WriteString(`Value: ` + d.Value + "\n")
 	}
+	if d.TLSAttribute != `` {
+		b.WriteString(`TLS: ` + d.TLSAttribute + "\n")
+	}
 	if d.Pattern != nil {
 		b.WriteString(d.Pattern.String())
 	}
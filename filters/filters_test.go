@@ -47,6 +47,7 @@ func TestNewFilterFromDescription(t *testing.T) {
 		{`request headers`, RequestHeadersFilterType, &RequestHeadersFilter{NewKeyValueMatcher(nil, nil)}},
 		{`response headers`, ResponseHeadersFilterType, &ResponseHeadersFilter{NewKeyValueMatcher(nil, nil)}},
 		{`status`, StatusCodeFilterType, &StatusCodeFilter{NewRangeMatcher()}},
+		{`tls without attribute`, TLSFilterType, nil},
 		{`error`, ConnectionErrorFilterType, &ConnectionErrorFilter{}},
 		{`yes`, YesInternalFilter, &YesFilter{}},
 	}
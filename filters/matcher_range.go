@@ -154,6 +154,11 @@ func (d RangeMatcherDescription) String() string {
 		return ``
 	}
 
+	return `Range: ` + d.Matcher().String() + "\n"
+}
+
+// Matcher returns the RangeMatcher described by the description.
+func (d RangeMatcherDescription) Matcher() RangeMatcher {
 	rm := NewRangeMatcher()
 	if d.From != nil {
 		rm.From(d.ToInt(d.From))
@@ -167,5 +172,5 @@ func (d RangeMatcherDescription) String() string {
 	if d.ExcludeTo {
 		rm.ExcludeTo()
 	}
-	return `Range: ` + rm.String() + "\n"
+	return rm
 }
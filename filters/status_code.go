@@ -49,22 +49,8 @@ func (f *StatusCodeFilter) SetMatcher(matcher Matcher) error {
 }
 
 func statusCodeFilterFromDescription(filterMap FilterMap, fd *FilterDescription) Filter {
-	r := fd.Range
-	m := NewRangeMatcher()
-	if r.From != nil {
-		m.From(r.ToInt(r.From))
-	}
-	if r.To != nil {
-		m.To(r.ToInt(r.To))
-	}
-	if r.ExcludeFrom {
-		m.ExcludeFrom()
-	}
-	if r.ExcludeTo {
-		m.ExcludeTo()
-	}
 	f := &StatusCodeFilter{}
-	err := f.SetMatcher(m)
+	err := f.SetMatcher(fd.Range.Matcher())
 	if err != nil {
 		return nil
 	}
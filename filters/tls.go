@@ -0,0 +1,125 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/proxy"
+)
+
+// The TLS connection attributes a TLSFilter may match.
+const (
+	// TLSVersion matches the TLS version name, like "TLS 1.2", with a RegexpMatcher.
+	TLSVersion = `version`
+	// TLSCipherSuite matches the cipher suite IANA name with a RegexpMatcher.
+	TLSCipherSuite = `cipherSuite`
+	// TLSProtocol matches the ALPN negotiated protocol, like "h2", with a RegexpMatcher.
+	TLSProtocol = `alpnProtocol`
+	// TLSSubject matches the peer certificate subject with a RegexpMatcher.
+	TLSSubject = `certificateSubject`
+	// TLSIssuer matches the peer certificate issuer with a RegexpMatcher.
+	TLSIssuer = `certificateIssuer`
+	// TLSExpiresInDays matches the number of days until the peer certificate
+	// expires with a RangeMatcher. It is negative for expired certificates.
+	TLSExpiresInDays = `expiresInDays`
+)
+
+// TLSFilter provides a filter for the TLS connection details of API calls,
+// like the negotiated TLS version or the expiry of the server certificate.
+//
+// It never matches calls made without TLS.
+type TLSFilter struct {
+	// Attribute is one of the TLS* attribute names. It selects the kind of
+	// Matcher the filter accepts.
+	Attribute string
+	Matcher
+}
+
+// Type is part of the Filter interface.
+func (*TLSFilter) Type() FilterType {
+	return TLSFilterType
+}
+
+func (f *TLSFilter) ensureMatcher() {
+	if f.Matcher != nil {
+		return
+	}
+	_ = f.SetMatcher(nil)
+}
+
+// MatchesCall is part of the Filter interface.
+func (f *TLSFilter) MatchesCall(e events.Event) bool {
+	response := e.Response()
+	if response == nil || response.TLS == nil {
+		return false
+	}
+	f.ensureMatcher()
+	rt := proxy.NewReportTLS(response.TLS)
+	switch f.Attribute {
+	case TLSVersion:
+		return f.Matches(rt.Version)
+	case TLSCipherSuite:
+		return f.Matches(rt.CipherSuite)
+	case TLSProtocol:
+		return f.Matches(rt.Protocol)
+	case TLSSubject:
+		return f.Matches(rt.CertificateSubject)
+	case TLSIssuer:
+		return f.Matches(rt.CertificateIssuer)
+	case TLSExpiresInDays:
+		if len(response.TLS.PeerCertificates) == 0 {
+			return false
+		}
+		remaining := time.Until(response.TLS.PeerCertificates[0].NotAfter)
+		return f.Matches(int(math.Floor(remaining.Hours() / 24)))
+	default:
+		return false
+	}
+}
+
+// SetMatcher sets the filter Matcher: a RangeMatcher for the TLSExpiresInDays
+// attribute, a RegexpMatcher for the other ones. A nil Matcher means any value.
+//
+// If the returned error is not nil, the Matcher is rejected.
+func (f *TLSFilter) SetMatcher(matcher Matcher) error {
+	if f.Attribute == TLSExpiresInDays {
+		if matcher == nil {
+			matcher = NewRangeMatcher()
+		}
+		if _, ok := matcher.(RangeMatcher); !ok {
+			f.ensureMatcher()
+			return fmt.Errorf("the TLSFilter only accepts RangeMatchers for %s: got %T", f.Attribute, matcher)
+		}
+	} else {
+		if matcher == nil {
+			matcher = NewEmptyRegexpMatcher()
+		}
+		if _, ok := matcher.(RegexpMatcher); !ok {
+			f.ensureMatcher()
+			return fmt.Errorf("the TLSFilter only accepts RegexpMatchers for %s: got %T", f.Attribute, matcher)
+		}
+	}
+	f.Matcher = matcher
+	return nil
+}
+
+func tlsFilterFromDescription(_ FilterMap, fd *FilterDescription) Filter {
+	f := &TLSFilter{Attribute: fd.TLSAttribute}
+	var err error
+	switch fd.TLSAttribute {
+	case TLSExpiresInDays:
+		err = f.SetMatcher(fd.Range.Matcher())
+	case TLSVersion, TLSCipherSuite, TLSProtocol, TLSSubject, TLSIssuer:
+		// If the pattern is invalid, the matcher will be nil, and SetMatcher will
+		// apply the EmptyRegexpMatcher and not fail.
+		err = f.SetMatcher(NewRegexpMatcher(fd.PatternRegexp()))
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return f
+}
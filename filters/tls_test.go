@@ -0,0 +1,112 @@
+package filters
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bearer/go-agent/events"
+)
+
+func testTLSState(expiresIn time.Duration) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		Version:            tls.VersionTLS12,
+		CipherSuite:        tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		NegotiatedProtocol: `h2`,
+		PeerCertificates: []*x509.Certificate{{
+			Subject:  pkix.Name{CommonName: `api.example.com`},
+			Issuer:   pkix.Name{CommonName: `Example CA`},
+			NotAfter: time.Now().Add(expiresIn),
+		}},
+	}
+}
+
+func TestTLSFilter_MatchesCall(t *testing.T) {
+	const day = 24 * time.Hour
+	within30Days := NewRangeMatcher().From(0).To(30)
+	tests := []struct {
+		name      string
+		attribute string
+		matcher   Matcher
+		state     *tls.ConnectionState
+		want      bool
+	}{
+		{`version`, TLSVersion, NewRegexpMatcher(regexp.MustCompile(`^TLS 1\.[23]$`)), testTLSState(day), true},
+		{`cipher suite`, TLSCipherSuite, NewRegexpMatcher(regexp.MustCompile(`CBC`)), testTLSState(day), false},
+		{`alpn`, TLSProtocol, NewRegexpMatcher(regexp.MustCompile(`^h2$`)), testTLSState(day), true},
+		{`subject`, TLSSubject, NewRegexpMatcher(regexp.MustCompile(`example\.com`)), testTLSState(day), true},
+		{`issuer`, TLSIssuer, NewRegexpMatcher(regexp.MustCompile(`^CN=Example CA$`)), testTLSState(day), true},
+		{`expiring soon`, TLSExpiresInDays, within30Days, testTLSState(10*day + time.Hour), true},
+		{`expiring later`, TLSExpiresInDays, within30Days, testTLSState(90 * day), false},
+		{`expired`, TLSExpiresInDays, NewRangeMatcher().To(-1), testTLSState(-time.Hour), true},
+		{`no certificate`, TLSExpiresInDays, NewRangeMatcher(), &tls.ConnectionState{}, false},
+		{`no TLS`, TLSVersion, nil, nil, false},
+		{`unknown attribute`, `foo`, nil, testTLSState(day), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &TLSFilter{Attribute: tt.attribute}
+			if err := f.SetMatcher(tt.matcher); err != nil {
+				t.Fatalf("SetMatcher() error = %v", err)
+			}
+			e := &events.EventBase{}
+			e.SetResponse(&http.Response{TLS: tt.state})
+			if got := f.MatchesCall(e); got != tt.want {
+				t.Errorf("MatchesCall() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSFilter_SetMatcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		attribute string
+		matcher   Matcher
+		wantErr   bool
+	}{
+		{"happy regexp", TLSVersion, NewEmptyRegexpMatcher(), false},
+		{"happy range", TLSExpiresInDays, NewRangeMatcher(), false},
+		{"nil", TLSExpiresInDays, nil, false},
+		{"sad regexp", TLSExpiresInDays, NewEmptyRegexpMatcher(), true},
+		{"sad range", TLSSubject, NewRangeMatcher(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &TLSFilter{Attribute: tt.attribute}
+			if err := f.SetMatcher(tt.matcher); (err != nil) != tt.wantErr {
+				t.Errorf("SetMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if f.Matcher == nil {
+				t.Error("SetMatcher() left a nil matcher")
+			}
+		})
+	}
+}
+
+func Test_tlsFilterFromDescription(t *testing.T) {
+	tests := []struct {
+		name string
+		fd   FilterDescription
+		want bool
+	}{
+		{`range`, FilterDescription{TLSAttribute: TLSExpiresInDays, Range: RangeMatcherDescription{From: 0, To: 30.0}}, true},
+		{`pattern`, FilterDescription{TLSAttribute: TLSVersion, Pattern: &RegexpMatcherDescription{Value: `1\.0`}}, true},
+		{`unknown attribute`, FilterDescription{TLSAttribute: `foo`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tlsFilterFromDescription(nil, &tt.fd)
+			if (got != nil) != tt.want {
+				t.Fatalf("tlsFilterFromDescription() = %v, want a filter: %t", got, tt.want)
+			}
+			if got != nil && got.(*TLSFilter).Attribute != tt.fd.TLSAttribute {
+				t.Errorf("tlsFilterFromDescription() attribute = %s, want %s", got.(*TLSFilter).Attribute, tt.fd.TLSAttribute)
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ module github.com/bearer/go-agent
 go 1.13
 
 require (
+	github.com/andybalholm/brotli v1.0.2
 	github.com/davecgh/go-spew v1.1.1
 	github.com/golang/protobuf v1.4.2
+	github.com/klauspost/compress v1.11.13
 	github.com/rs/zerolog v1.19.0
 	github.com/tdewolff/minify/v2 v2.7.6
+	google.golang.org/grpc v1.30.0
 	google.golang.org/protobuf v1.24.0
 )
@@ -0,0 +1,383 @@
+// Package grpcagent instruments the gRPC client calls of the applications
+// using the Bearer agent. It is separate from the agent package, so that only
+// the applications using gRPC depend on it.
+package grpcagent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	protoV1 "github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	agent "github.com/bearer/go-agent"
+	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/interception"
+	"github.com/bearer/go-agent/proxy"
+)
+
+// defaultPort is the port used by gRPC for targets without one.
+const defaultPort = `443`
+
+// DialOptions returns the grpc.DialOption values adding the instrumentation of
+// an Agent to the unary and streaming calls of a gRPC client connection:
+//
+//	conn, err := grpc.Dial(target, append(yourOptions, grpcagent.DialOptions(a)...)...)
+//
+// It returns no options if the agent is not active.
+func DialOptions(a *agent.Agent) []grpc.DialOption {
+	rt := a.Instrumentation()
+	if rt == nil {
+		return nil
+	}
+	i := &Interceptor{
+		Dispatcher:      rt.Dispatcher,
+		MaximumBodySize: rt.MaximumBodySize,
+		FailOpen:        rt.FailOpen,
+		Diagnostics:     rt.Diagnostics,
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(i.UnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(i.StreamClientInterceptor),
+	}
+}
+
+// Interceptor provides the gRPC client interceptors instrumenting gRPC
+// calls.
+//
+// Since filters and data collection rules work on HTTP requests and
+// responses, each gRPC call is represented as the HTTP/2 exchange carrying it:
+//   - the URL is grpc://host:port/package.Service/Method
+//   - the request method is POST
+//   - the request and response headers are the call metadata
+//   - the response status code is the HTTP equivalent of the gRPC status code,
+//     which is available in the Grpc-Status response header
+//   - the bodies are the JSON representations of the protobuf messages, in an
+//     array for streaming calls.
+//
+// Errors without a gRPC status, which happen before any response, are reported
+// like connection errors.
+type Interceptor struct {
+	events.Dispatcher
+
+	// MaximumBodySize is the largest body size to store whole, as in
+	// interception.RoundTripper.
+	MaximumBodySize int
+
+	// FailOpen and Diagnostics divert the errors of the Bearer stages, as in
+	// interception.RoundTripper, so that the interceptors always return the result of the
+	// gRPC call.
+	FailOpen    bool
+	Diagnostics interception.Diagnoser
+}
+
+// stages returns a RoundTripper sharing the Interceptor configuration, to run
+// the Bearer stages.
+func (i *Interceptor) stages() *interception.RoundTripper {
+	return &interception.RoundTripper{
+		Dispatcher:      i.Dispatcher,
+		MaximumBodySize: i.MaximumBodySize,
+		FailOpen:        i.FailOpen,
+		Diagnostics:     i.Diagnostics,
+	}
+}
+
+// grpcURL builds the URL of the request representing a gRPC call, from the
+// dial target, possibly including a resolver scheme as in dns:///host:port,
+// and the full method name.
+func grpcURL(target, method string) *url.URL {
+	endpoint := target
+	if i := strings.Index(endpoint, `://`); i >= 0 {
+		endpoint = endpoint[i+len(`://`):]
+		// Skip the resolver authority.
+		if j := strings.Index(endpoint, `/`); j >= 0 {
+			endpoint = endpoint[j+1:]
+		}
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		host, port = endpoint, defaultPort
+	}
+	if strings.HasPrefix(target, `unix:`) {
+		host = `localhost`
+	}
+	return &url.URL{Scheme: interception.GRPCScheme, Host: net.JoinHostPort(host, port), Path: method}
+}
+
+// grpcHeader converts gRPC metadata to a HTTP header.
+func grpcHeader(mds ...metadata.MD) http.Header {
+	header := make(http.Header)
+	for _, md := range mds {
+		for k, vs := range md {
+			for _, v := range vs {
+				header.Add(k, v)
+			}
+		}
+	}
+	return header
+}
+
+// grpcHTTPStatus returns the HTTP status code equivalent to a gRPC status code.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client Closed Request, as in nginx.
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcBody accumulates the JSON representations of the gRPC messages of a
+// call, up to limit bytes.
+type grpcBody struct {
+	m         sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	streaming bool
+	// binary is true if a message has no JSON representation.
+	binary bool
+	// size is the size of the complete JSON representation, unless cut is
+	// true, in which case messages past the limit were skipped.
+	size int64
+	cut  bool
+}
+
+// add adds a message to the body.
+func (b *grpcBody) add(msg interface{}) {
+	var m proto.Message
+	switch msg := msg.(type) {
+	case proto.Message:
+		m = msg
+	case protoV1.Message:
+		m = protoV1.MessageV2(msg)
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	// Past the limit, the body is reported as too long or truncated whatever
+	// the next messages, so they are not marshaled.
+	if b.buf.Len() > b.limit {
+		b.cut = true
+		return
+	}
+	if m == nil {
+		b.binary = true
+		return
+	}
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		b.binary = true
+		return
+	}
+	if b.streaming && b.size > 0 {
+		data = append([]byte{','}, data...)
+	}
+	b.size += int64(len(data))
+	if room := b.limit + 1 - b.buf.Len(); len(data) > room {
+		data = data[:room]
+	}
+	b.buf.Write(data)
+}
+
+// body returns a BodyReadCloser on the accumulated body, its declared length,
+// and its content type.
+func (b *grpcBody) body() (io.ReadCloser, int64, string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.binary {
+		// The wire format is unknown, but any non-empty body with this
+		// content type is reported as binary.
+		return interception.NewBodyReadCloser(ioutil.NopCloser(strings.NewReader(interception.BodyIsBinary)), b.limit+1), -1, interception.GRPCContentType
+	}
+	data, size := b.buf.Bytes(), b.size
+	if b.streaming {
+		data = append(append([]byte{'['}, data...), ']')
+		size += 2
+	}
+	if b.cut {
+		// Only a lower bound of the size is known.
+		size = -1
+	}
+	return interception.NewBodyReadCloser(ioutil.NopCloser(bytes.NewReader(data)), b.limit+1), size, interception.GRPCJSONContentType
+}
+
+// grpcCall holds the state of an instrumented gRPC call across its stages.
+type grpcCall struct {
+	*interception.Call
+	request *http.Request
+
+	requestBody, responseBody *grpcBody
+}
+
+// begin runs the connect and request stages of a gRPC call. It returns an
+// error if these stages fail, in which case the call must not be performed,
+// except in FailOpen mode, where the call is performed without instrumentation.
+func (i *Interceptor) begin(ctx context.Context, target, method string, streaming bool) (*grpcCall, error) {
+	u := grpcURL(target, method)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	header := grpcHeader(md)
+	header.Set(proxy.ContentTypeHeader, interception.GRPCJSONContentType)
+	c := &grpcCall{request: (&http.Request{
+		Method:     http.MethodPost,
+		URL:        u,
+		Proto:      `HTTP/2.0`,
+		ProtoMajor: 2,
+		Header:     header,
+		Host:       u.Host,
+	}).WithContext(ctx)}
+
+	var err error
+	if c.Call, err = i.stages().BeginCall(ctx, c.request); err != nil {
+		return nil, err
+	}
+	limit := c.MaximumBodySize()
+	c.requestBody = &grpcBody{limit: limit, streaming: streaming}
+	c.responseBody = &grpcBody{limit: limit, streaming: streaming}
+	return c, nil
+}
+
+// end runs the response and bodies stages of a gRPC call, and reports it.
+func (c *grpcCall) end(header, trailer metadata.MD, err error) {
+	if !c.IsActive() {
+		return
+	}
+	var ct string
+	c.request.Body, c.request.ContentLength, ct = c.requestBody.body()
+	c.request.Header.Set(proxy.ContentTypeHeader, ct)
+
+	st, ok := status.FromError(err)
+	if !ok {
+		c.Fail(err)
+		return
+	}
+
+	response := &http.Response{
+		Status:     st.Code().String(),
+		StatusCode: grpcHTTPStatus(st.Code()),
+		Proto:      `HTTP/2.0`,
+		ProtoMajor: 2,
+		Header:     grpcHeader(header, trailer),
+		Request:    c.request,
+	}
+	response.Body, response.ContentLength, ct = c.responseBody.body()
+	response.Header.Set(proxy.ContentTypeHeader, ct)
+	response.Header.Set(interception.GRPCStatusHeader, strconv.Itoa(int(st.Code())))
+	if st.Message() != `` {
+		response.Header.Set(interception.GRPCMessageHeader, st.Message())
+	}
+	c.End(response)
+}
+
+// UnaryClientInterceptor is a grpc.UnaryClientInterceptor instrumenting unary
+// gRPC calls.
+func (i *Interceptor) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c, err := i.begin(ctx, cc.Target(), method, false)
+	if err != nil {
+		return err
+	}
+	if !c.IsActive() {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	var header, trailer metadata.MD
+	callOpts := make([]grpc.CallOption, 0, len(opts)+2)
+	callOpts = append(append(callOpts, opts...), grpc.Header(&header), grpc.Trailer(&trailer))
+	c.requestBody.add(req)
+	err = invoker(ctx, method, req, reply, cc, callOpts...)
+	if err == nil {
+		c.responseBody.add(reply)
+	}
+	c.end(header, trailer, err)
+	return err
+}
+
+// StreamClientInterceptor is a grpc.StreamClientInterceptor instrumenting
+// streaming gRPC calls. The calls are reported when the stream ends, which is
+// when RecvMsg returns an error, including io.EOF, or its single response for
+// client-streaming calls.
+func (i *Interceptor) StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
+	cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	c, err := i.begin(ctx, cc.Target(), method, true)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if !c.IsActive() {
+		return cs, err
+	}
+	if err != nil {
+		c.end(nil, nil, err)
+		return nil, err
+	}
+	return &grpcClientStream{ClientStream: cs, call: c, serverStreams: desc.ServerStreams}, nil
+}
+
+// grpcClientStream is the instrumented grpc.ClientStream used by the
+// StreamClientInterceptor.
+type grpcClientStream struct {
+	grpc.ClientStream
+	call          *grpcCall
+	serverStreams bool
+	once          sync.Once
+}
+
+// SendMsg implements the grpc.ClientStream interface.
+func (s *grpcClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.call.requestBody.add(m)
+	}
+	return err
+}
+
+// RecvMsg implements the grpc.ClientStream interface.
+func (s *grpcClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.call.responseBody.add(m)
+	}
+	if err != nil || !s.serverStreams {
+		s.once.Do(func() {
+			header, _ := s.Header()
+			callErr := err
+			if callErr == io.EOF {
+				callErr = nil
+			}
+			s.call.end(header, s.Trailer(), callErr)
+		})
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package grpcagent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	agent "github.com/bearer/go-agent"
+	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/interception"
+	"github.com/bearer/go-agent/proxy"
+)
+
+func TestGRPCURL(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{`bufnet`, `grpc://bufnet:443/pkg.Service/Method`},
+		{`localhost:50051`, `grpc://localhost:50051/pkg.Service/Method`},
+		{`dns:///example.com:8443`, `grpc://example.com:8443/pkg.Service/Method`},
+		{`dns://8.8.8.8/example.com`, `grpc://example.com:443/pkg.Service/Method`},
+		{`unix:///tmp/grpc.sock`, `grpc://localhost:443/pkg.Service/Method`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := grpcURL(tt.target, `/pkg.Service/Method`).String(); got != tt.want {
+				t.Errorf(`grpcURL() = %s, want %s`, got, tt.want)
+			}
+		})
+	}
+}
+
+// dialTestGRPC starts an in-process health server, and returns it with a
+// client connection instrumented by i to it, and a function stopping both.
+func dialTestGRPC(t *testing.T, i *Interceptor) (*grpc.Server, *grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus(`up`, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, hs)
+	go func() { _ = server.Serve(listener) }()
+
+	conn, err := grpc.Dial(`bufnet`,
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(i.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(i.StreamClientInterceptor),
+	)
+	if err != nil {
+		server.Stop()
+		t.Fatalf(`dialing test server: %v`, err)
+	}
+	return server, conn, func() {
+		_ = conn.Close()
+		server.Stop()
+	}
+}
+
+// testReportRecorder returns a dispatcher parsing bodies and recording the
+// ReportEvent events, and a function returning them.
+func testReportRecorder() (events.Dispatcher, func() []*interception.ReportEvent) {
+	var m sync.Mutex
+	var reports []*interception.ReportEvent
+	dispatcher := events.NewDispatcher()
+	dispatcher.AddProviders(interception.TopicBodies, interception.BodyParsingProvider{})
+	dispatcher.AddProviders(interception.TopicReport, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+		return []events.Listener{func(_ context.Context, e events.Event) error {
+			m.Lock()
+			defer m.Unlock()
+			reports = append(reports, e.(*interception.ReportEvent))
+			return nil
+		}}
+	}))
+	return dispatcher, func() []*interception.ReportEvent {
+		m.Lock()
+		defer m.Unlock()
+		return reports
+	}
+}
+
+func TestInterceptor_UnaryClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    string
+		wantCode   codes.Code
+		wantStatus int
+		wantBody   interface{}
+	}{
+		{`happy`, `up`, codes.OK, http.StatusOK, map[string]interface{}{`status`: `SERVING`}},
+		{`not found`, `down`, codes.NotFound, http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			_, conn, stop := dialTestGRPC(t, &Interceptor{Dispatcher: dispatcher})
+			defer stop()
+			ctx := metadata.AppendToOutgoingContext(context.Background(), `x-caller`, `test`)
+
+			_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: tt.service})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf(`Check() error = %v, want code %s`, err, tt.wantCode)
+			}
+			if len(reports()) != 1 {
+				t.Fatalf(`got %d reports, want 1`, len(reports()))
+			}
+			rev := reports()[0]
+			if rev.Stage != proxy.StageBodies || rev.Error != nil {
+				t.Errorf(`report stage/error = %s/%v, want %s/nil`, rev.Stage, rev.Error, proxy.StageBodies)
+			}
+			request, response := rev.Request(), rev.Response()
+			if u := request.URL.String(); u != `grpc://bufnet:443/grpc.health.v1.Health/Check` {
+				t.Errorf(`report URL = %s`, u)
+			}
+			if caller := request.Header.Get(`X-Caller`); caller != `test` {
+				t.Errorf(`report request metadata x-caller = %q, want test`, caller)
+			}
+			want := map[string]interface{}{`service`: tt.service}
+			if !reflect.DeepEqual(rev.RequestBody, want) {
+				t.Errorf(`report request body = %#v, want %#v`, rev.RequestBody, want)
+			}
+			if response.StatusCode != tt.wantStatus || interception.GRPCStatusName(response.Header) != tt.wantCode.String() {
+				t.Errorf(`report status = %d/%s, want %d/%s`, response.StatusCode,
+					interception.GRPCStatusName(response.Header), tt.wantStatus, tt.wantCode)
+			}
+			if tt.wantBody != nil && !reflect.DeepEqual(rev.ResponseBody, tt.wantBody) {
+				t.Errorf(`report response body = %#v, want %#v`, rev.ResponseBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestInterceptor_StreamClientInterceptor(t *testing.T) {
+	dispatcher, reports := testReportRecorder()
+	server, conn, stop := dialTestGRPC(t, &Interceptor{Dispatcher: dispatcher})
+	defer stop()
+
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{Service: `up`})
+	if err != nil {
+		t.Fatalf(`Watch() error = %v`, err)
+	}
+	if _, err = stream.Recv(); err != nil {
+		t.Fatalf(`Recv() error = %v`, err)
+	}
+	if len(reports()) != 0 {
+		t.Fatalf(`got %d reports before the stream end, want 0`, len(reports()))
+	}
+	server.Stop()
+	if _, err = stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf(`Recv() error = %v, want code %s`, err, codes.Unavailable)
+	}
+	if len(reports()) != 1 {
+		t.Fatalf(`got %d reports, want 1`, len(reports()))
+	}
+	rev := reports()[0]
+	if code := rev.Response().StatusCode; code != http.StatusServiceUnavailable {
+		t.Errorf(`report status = %d, want %d`, code, http.StatusServiceUnavailable)
+	}
+	wantRequest := []interface{}{map[string]interface{}{`service`: `up`}}
+	if !reflect.DeepEqual(rev.RequestBody, wantRequest) {
+		t.Errorf(`report request body = %#v, want %#v`, rev.RequestBody, wantRequest)
+	}
+	wantResponse := []interface{}{map[string]interface{}{`status`: `SERVING`}}
+	if !reflect.DeepEqual(rev.ResponseBody, wantResponse) {
+		t.Errorf(`report response body = %#v, want %#v`, rev.ResponseBody, wantResponse)
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	if opts := DialOptions(agent.New(`not a key`)); opts != nil {
+		t.Errorf(`DialOptions() of an inactive agent = %v, want none`, opts)
+	}
+}
+
+func TestGRPCBody_Limit(t *testing.T) {
+	b := &grpcBody{limit: 10, streaming: true}
+	b.add(&healthpb.HealthCheckRequest{Service: strings.Repeat(`a`, 100)})
+	if b.buf.Len() != 11 || b.cut {
+		t.Fatalf(`captured %d bytes, cut %t, want 11, false`, b.buf.Len(), b.cut)
+	}
+	b.add(&healthpb.HealthCheckRequest{Service: `b`})
+	if b.buf.Len() != 11 || !b.cut {
+		t.Errorf(`captured %d bytes, cut %t after the limit, want 11, true`, b.buf.Len(), b.cut)
+	}
+	if _, size, _ := b.body(); size != -1 {
+		t.Errorf(`body size = %d, want unknown`, size)
+	}
+}
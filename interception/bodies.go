@@ -4,19 +4,40 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/bearer/go-agent/events"
 	"github.com/bearer/go-agent/proxy"
 )
 
 // BodyReadCloser wraps a io.ReadCloser to give access to the first peekSize
-// bytes without interfering with the normal behaviour
+// bytes without interfering with the normal behaviour.
+//
+// The bytes read by the application are captured as they are read, so a body
+// can be consumed incrementally: it is only read ahead of the application when
+// Peek is called before enough of it was read.
 type BodyReadCloser struct {
+	m          sync.Mutex
 	peekSize   int
 	peekBuffer []byte
+	// peekError is the error returned by the underlying io.ReadCloser, io.EOF
+	// once the whole body has been read.
 	peekError  error
 	pos        int
 	readCloser io.ReadCloser
+	closed     bool
+	// detached is set once the application no longer reads the body, like
+	// a request body after its handler returned: it is not read ahead either.
+	detached bool
+
+	// completedAt is the time the end of the body was reached, if it was.
+	completedAt time.Time
+
+	// onDone, if set, is called once when the end of the body is reached or
+	// when the body is closed, whichever comes first.
+	onDone   func()
+	doneOnce sync.Once
 }
 
 // NewBodyReadCloser constructs a BodyReadCloser wrapper
@@ -30,63 +51,160 @@ func NewBodyReadCloser(readCloser io.ReadCloser, peekSize int) *BodyReadCloser {
 
 // Read gives the usual io.Reader behaviour
 func (r *BodyReadCloser) Read(p []byte) (int, error) {
-	if r.peekBuffer == nil || r.pos < len(r.peekBuffer) {
-		r.ensurePeekBuffer()
-		to := r.pos + len(p)
-		if to > len(r.peekBuffer) {
-			to = len(r.peekBuffer)
-		}
-		peekN := copy(p, r.peekBuffer[r.pos:to])
-		r.pos += peekN
-
+	r.m.Lock()
+	if r.pos < len(r.peekBuffer) {
+		n := copy(p, r.peekBuffer[r.pos:])
+		r.pos += n
+		err := r.peekError
 		// Only return EOF when we've read past the peeked position
-		if r.peekError != nil && (r.peekError != io.EOF || r.pos >= len(r.peekBuffer)) {
-			return peekN, r.peekError
+		if err == io.EOF && r.pos < len(r.peekBuffer) {
+			err = nil
 		}
-
-		// Read beyond the peek buffer if neccessary
-		if peekN < len(p) {
-			n, err := r.readCloser.Read(p[peekN:])
-			r.pos += n
-			return peekN + n, err
+		r.m.Unlock()
+		if err == io.EOF {
+			r.done()
 		}
+		return n, err
+	}
+	if r.peekError != nil {
+		err := r.peekError
+		r.m.Unlock()
+		return 0, err
+	}
+	r.m.Unlock()
+
+	// Do not hold the lock while reading, so Close may interrupt the read.
+	n, err := r.readCloser.Read(p)
 
-		return peekN, nil
+	r.m.Lock()
+	r.capture(p[:n], err)
+	r.pos += n
+	r.m.Unlock()
+	if err == io.EOF {
+		r.done()
 	}
+	return n, err
+}
 
-	return r.readCloser.Read(p)
+// capture appends the bytes read from the underlying io.ReadCloser to the
+// peek buffer, up to peekSize, and records the read error.
+func (r *BodyReadCloser) capture(p []byte, err error) {
+	if room := r.peekSize - len(r.peekBuffer); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		r.peekBuffer = append(r.peekBuffer, p...)
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	// Errors caused by closing the body are not errors of the body itself.
+	if err != nil && !r.closed {
+		r.peekError = err
+	}
+	r.checkCompletion(r.peekError)
+}
+
+// checkCompletion records the completion time of the body on the first io.EOF.
+func (r *BodyReadCloser) checkCompletion(err error) {
+	if err == io.EOF && r.completedAt.IsZero() {
+		r.completedAt = time.Now()
+	}
 }
 
-// Peek returns the result of reading the first peek bytes block
+// Peek returns the result of reading the first peek bytes block. Unless the
+// body was closed or detached, it reads ahead of the application as needed.
 func (r *BodyReadCloser) Peek() ([]byte, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
 	r.ensurePeekBuffer()
 	return r.peekBuffer, r.peekError
 }
 
 func (r *BodyReadCloser) ensurePeekBuffer() {
-	if r.peekBuffer != nil {
+	if r.closed || r.detached || r.peekError != nil || len(r.peekBuffer) >= r.peekSize {
 		return
 	}
 
-	buffer := make([]byte, r.peekSize)
+	buffer := make([]byte, r.peekSize-len(r.peekBuffer))
 	n, err := io.ReadFull(r.readCloser, buffer)
-	r.peekBuffer = buffer[:n]
+	r.capture(buffer[:n], err)
+}
 
-	r.peekError = err
-	if err == io.ErrUnexpectedEOF {
+// detach stops the capture at the bytes read by the application so far. The
+// body is complete if they amount to its declared length, even if the end of
+// the underlying io.ReadCloser was not reached.
+func (r *BodyReadCloser) detach(length int64) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.detached = true
+	if r.peekError == nil && length >= 0 && int64(r.pos) == length {
 		r.peekError = io.EOF
+		r.checkCompletion(r.peekError)
 	}
 }
 
+// incomplete checks whether the body was closed or detached before it was
+// captured up to peekSize, in which case the peeked bytes are only a prefix of
+// the body.
+func (r *BodyReadCloser) incomplete() bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.peekError == nil && len(r.peekBuffer) < r.peekSize
+}
+
+// maximumSize returns the largest body size the BodyReadCloser captures whole.
+func (r *BodyReadCloser) maximumSize() int {
+	return r.peekSize - 1
+}
+
+// setMaximumSize changes the largest body size the BodyReadCloser captures
+// whole, unless the body has already been read.
+func (r *BodyReadCloser) setMaximumSize(size int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.peekBuffer == nil && r.peekError == nil {
+		r.peekSize = size + 1
+	}
+}
+
+// completionTime returns the time the end of the body was reached, or the zero
+// time if it was not.
+func (r *BodyReadCloser) completionTime() time.Time {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.completedAt
+}
+
+// done calls the onDone callback, once.
+func (r *BodyReadCloser) done() {
+	r.doneOnce.Do(func() {
+		if r.onDone != nil {
+			r.onDone()
+		}
+	})
+}
+
 // Close closes the underlying io.ReadCloser
 func (r *BodyReadCloser) Close() error {
-	return r.readCloser.Close()
+	r.m.Lock()
+	r.closed = true
+	r.m.Unlock()
+	err := r.readCloser.Close()
+	r.done()
+	return err
 }
 
 // BodyParsingProvider is an events.Listener provider returning listeners
 // performing data collection, hashing, and sanitization on request/reponse
 // bodies.
-type BodyParsingProvider struct{}
+type BodyParsingProvider struct {
+	// TruncatedBodySize is the size of the prefix kept from JSON and text
+	// bodies too long to be captured whole, or not read whole by the
+	// application. If it is 0, such bodies are replaced by BodyTooLong, or
+	// BodyPartial respectively.
+	TruncatedBodySize int
+}
 
 // Listeners implements events.ListenerProvider.
 func (p BodyParsingProvider) Listeners(e events.Event) (l []events.Listener) {
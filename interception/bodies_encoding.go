@@ -0,0 +1,75 @@
+package interception
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ContentEncodingHeader is the canonical content encoding header name.
+const ContentEncodingHeader = `Content-Encoding`
+
+// errUnsupportedEncoding is returned by decodeBody for unknown content encodings.
+var errUnsupportedEncoding = errors.New(`unsupported content encoding`)
+
+// decodeBody decodes a peeked body according to the value of its
+// Content-Encoding header, undoing the encodings in the reverse order of their
+// application. The complete flag tells whether the peeked bytes are the whole
+// body or only its prefix.
+//
+// The decoded body is limited to maxSize+1 bytes. It returns partial
+// as true if the decoded body is only a prefix of the actual decoded body,
+// either because of the size limit or because the peeked body is incomplete.
+func decodeBody(body []byte, contentEncoding string, complete bool, maxSize int) (decoded []byte, partial bool, err error) {
+	decoded = body
+	partial = !complete
+	if contentEncoding == `` {
+		return decoded, partial, nil
+	}
+	encodings := strings.Split(contentEncoding, `,`)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == `` || encoding == `identity` {
+			continue
+		}
+		var r io.Reader
+		switch encoding {
+		case `gzip`, `x-gzip`:
+			r, err = gzip.NewReader(bytes.NewReader(decoded))
+		case `deflate`:
+			// HTTP deflate is zlib-wrapped, but some servers send raw deflate.
+			r, err = zlib.NewReader(bytes.NewReader(decoded))
+			if err != nil {
+				r, err = flate.NewReader(bytes.NewReader(decoded)), nil
+			}
+		case `br`:
+			r = brotli.NewReader(bytes.NewReader(decoded))
+		default:
+			return nil, false, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("decoding %s body: %w", encoding, err)
+		}
+
+		out, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+		if err != nil {
+			// A truncated stream still yields a usable prefix.
+			if !partial || len(out) == 0 {
+				return nil, false, fmt.Errorf("decoding %s body: %w", encoding, err)
+			}
+		}
+		if len(out) > maxSize {
+			partial = true
+		}
+		decoded = out
+	}
+	return decoded, partial, nil
+}
@@ -0,0 +1,127 @@
+package interception
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+// encodeTestBody applies an HTTP content encoding to a body.
+func encodeTestBody(t *testing.T, encoding string, body []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case `gzip`:
+		w = gzip.NewWriter(&buf)
+	case `deflate`:
+		w = zlib.NewWriter(&buf)
+	case `raw deflate`:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case `br`:
+		w = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf(`unexpected test encoding %s`, encoding)
+	}
+	if _, err := w.Write(body); err != nil {
+		t.Fatalf(`encoding test body: %v`, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf(`closing test body encoder: %v`, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	plain := []byte(`{"hello":"world"}`)
+	gzipped := encodeTestBody(t, `gzip`, plain)
+	tests := []struct {
+		name        string
+		body        []byte
+		encoding    string
+		complete    bool
+		want        []byte
+		wantPartial bool
+		wantErr     error
+	}{
+		{`identity`, plain, `identity`, true, plain, false, nil},
+		{`gzip`, gzipped, `gzip`, true, plain, false, nil},
+		{`deflate`, encodeTestBody(t, `deflate`, plain), `deflate`, true, plain, false, nil},
+		{`raw deflate`, encodeTestBody(t, `raw deflate`, plain), `Deflate`, true, plain, false, nil},
+		{`brotli`, encodeTestBody(t, `br`, plain), `br`, true, plain, false, nil},
+		{`chained`, encodeTestBody(t, `br`, gzipped), `gzip, br`, true, plain, false, nil},
+		{`sad unsupported`, plain, `zstd`, true, nil, false, errUnsupportedEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, partial, err := decodeBody(tt.body, tt.encoding, tt.complete, MaximumBodySize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf(`decodeBody() error = %v, want %v`, err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) || partial != tt.wantPartial {
+				t.Errorf(`decodeBody() = %s, %t, want %s, %t`, got, partial, tt.want, tt.wantPartial)
+			}
+		})
+	}
+}
+
+func TestDecodeBody_Partial(t *testing.T) {
+	plain := []byte(strings.Repeat(`0123456789`, 10000))
+	encoded := encodeTestBody(t, `gzip`, plain)
+
+	// Incomplete peeked body: a prefix is decoded.
+	got, partial, err := decodeBody(encoded[:len(encoded)/2], `gzip`, false, MaximumBodySize)
+	if err != nil {
+		t.Fatalf(`decodeBody() error = %v`, err)
+	}
+	if !partial || len(got) == 0 || !bytes.HasPrefix(plain, got) {
+		t.Errorf(`got %d bytes partial %t, want a partial prefix`, len(got), partial)
+	}
+
+	// Complete but corrupted body.
+	if _, _, err = decodeBody(encoded[:len(encoded)/2], `gzip`, true, MaximumBodySize); err == nil {
+		t.Errorf(`decodeBody() succeeded on an incomplete complete body`)
+	}
+
+	// Decoded size exceeding the limit.
+	large := encodeTestBody(t, `gzip`, bytes.Repeat([]byte(`a`), 2*MaximumBodySize))
+	got, partial, err = decodeBody(large, `gzip`, true, MaximumBodySize)
+	if err != nil || !partial || len(got) != MaximumBodySize+1 {
+		t.Errorf(`got %d bytes, partial %t, error %v, want %d, true, nil`, len(got), partial, err, MaximumBodySize+1)
+	}
+}
+
+func TestBodyParsingProvider_EncodedResponseBody(t *testing.T) {
+	plain := []byte(`{"hello":"world"}`)
+	encoded := encodeTestBody(t, `br`, plain)
+	e := &BodiesEvent{}
+	res := &http.Response{
+		Header: http.Header{
+			proxy.ContentTypeHeader: {proxy.ContentTypeJSON},
+			ContentEncodingHeader:   {`br`},
+		},
+		Body: testReader(string(encoded)),
+	}
+	e.SetResponse(res)
+	if err := (BodyParsingProvider{}).ResponseBodyParser(context.Background(), e); err != nil {
+		t.Fatalf(`ResponseBodyParser() error: %v`, err)
+	}
+	if want := map[string]interface{}{`hello`: `world`}; !reflect.DeepEqual(e.ResponseBody, want) {
+		t.Errorf(`got body %v, want %v`, e.ResponseBody, want)
+	}
+	if b, _ := ioutil.ReadAll(res.Body); !bytes.Equal(b, encoded) {
+		t.Errorf(`application did not receive the encoded body`)
+	}
+}
@@ -0,0 +1,94 @@
+package interception
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+const (
+	// MultipartFileName is the key of the file name in the representation of
+	// multipart file parts.
+	MultipartFileName = `filename`
+
+	// MultipartContentTypeKey is the key of the content type in the
+	// representation of multipart file parts.
+	MultipartContentTypeKey = `contentType`
+
+	// MultipartSize is the key of the content size in the representation of
+	// multipart file parts.
+	MultipartSize = `size`
+)
+
+// ParseMultipartFormData parses the peeked part of a multipart/form-data body
+// with the given content type into a map of field names to their values, the
+// complete flag telling whether the peeked part is the whole body.
+//
+// Text values are kept as strings, while file parts are reduced to a map of
+// their file name, content type, and size. The structure only contains
+// JSON-compatible types, so it can be sanitized and shape-hashed like a JSON
+// body.
+//
+// If the body is incomplete, the parts it contains entirely are returned,
+// along with the file part being read, whose size is then a lower bound.
+func ParseMultipartFormData(body []byte, contentType string, complete bool) (map[string]interface{}, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	boundary := params[`boundary`]
+	if boundary == `` {
+		return nil, errors.New(`no boundary in multipart content type`)
+	}
+
+	form := make(map[string]interface{})
+	add := func(name string, value interface{}) {
+		values, _ := form[name].([]interface{})
+		form[name] = append(values, value)
+	}
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			if complete || len(form) == 0 {
+				return nil, err
+			}
+			return form, nil
+		}
+
+		name := part.FormName()
+		if fileName := part.FileName(); fileName != `` {
+			size, err := io.Copy(ioutil.Discard, part)
+			if err != nil && complete {
+				return nil, err
+			}
+			add(name, map[string]interface{}{
+				MultipartFileName:       fileName,
+				MultipartContentTypeKey: part.Header.Get(proxy.ContentTypeHeader),
+				MultipartSize:           size,
+			})
+			if err != nil {
+				return form, nil
+			}
+			continue
+		}
+
+		value, err := ioutil.ReadAll(part)
+		if err != nil {
+			// Incomplete text values are dropped.
+			if complete {
+				return nil, err
+			}
+			return form, nil
+		}
+		add(name, string(value))
+	}
+}
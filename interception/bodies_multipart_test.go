@@ -0,0 +1,125 @@
+package interception
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+// makeTestMultipart builds a multipart/form-data body with a password field,
+// an email field, and a file part of fileSize bytes, returning it with its
+// content type.
+func makeTestMultipart(t *testing.T, fileSize int) ([]byte, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField(`password`, `hunter2`)
+	_ = w.WriteField(`contact`, `john.doe@example.com`)
+	h := make(textproto.MIMEHeader)
+	h.Set(`Content-Disposition`, `form-data; name="upload"; filename="report.pdf"`)
+	h.Set(proxy.ContentTypeHeader, `application/pdf`)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		t.Fatalf(`creating file part: %v`, err)
+	}
+	_, _ = part.Write(bytes.Repeat([]byte{0}, fileSize))
+	if err := w.Close(); err != nil {
+		t.Fatalf(`closing multipart writer: %v`, err)
+	}
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestParseMultipartFormData(t *testing.T) {
+	body, ct := makeTestMultipart(t, 1000)
+	tests := []struct {
+		name     string
+		body     []byte
+		ct       string
+		complete bool
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{`happy`, body, ct, true, map[string]interface{}{
+			`password`: []interface{}{`hunter2`},
+			`contact`:  []interface{}{`john.doe@example.com`},
+			`upload`: []interface{}{map[string]interface{}{
+				MultipartFileName:       `report.pdf`,
+				MultipartContentTypeKey: `application/pdf`,
+				MultipartSize:           int64(1000),
+			}},
+		}, false},
+		{`incomplete`, body[:len(body)-600], ct, false, map[string]interface{}{
+			`password`: []interface{}{`hunter2`},
+			`contact`:  []interface{}{`john.doe@example.com`},
+			`upload`: []interface{}{map[string]interface{}{
+				MultipartFileName:       `report.pdf`,
+				MultipartContentTypeKey: `application/pdf`,
+				// Lower bound, checked separately.
+				MultipartSize: int64(-1),
+			}},
+		}, false},
+		{`sad no boundary`, body, `multipart/form-data`, true, nil, true},
+		{`sad corrupted`, body[:len(body)-600], ct, true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMultipartFormData(tt.body, tt.ct, tt.complete)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(`ParseMultipartFormData() error = %v, wantErr %v`, err, tt.wantErr)
+			}
+			if wantFiles, ok := tt.want[`upload`].([]interface{}); ok && err == nil {
+				wantFile := wantFiles[0].(map[string]interface{})
+				gotFile := got[`upload`].([]interface{})[0].(map[string]interface{})
+				if wantFile[MultipartSize] == int64(-1) {
+					if size := gotFile[MultipartSize].(int64); size <= 0 || size >= 1000 {
+						t.Errorf(`got incomplete file size %d, want in ]0, 1000[`, size)
+					}
+					wantFile[MultipartSize] = gotFile[MultipartSize]
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf(`ParseMultipartFormData() = %v, want %v`, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyParsingProvider_MultipartRequestBody(t *testing.T) {
+	body, ct := makeTestMultipart(t, 2*MaximumBodySize)
+	req, _ := http.NewRequest(http.MethodPost, defaultTestURL, testReader(string(body)))
+	req.Header.Set(proxy.ContentTypeHeader, ct)
+	be := &BodiesEvent{}
+	be.SetRequest(req)
+	if err := (BodyParsingProvider{}).RequestBodyParser(context.Background(), be); err != nil {
+		t.Fatalf(`RequestBodyParser() error: %v`, err)
+	}
+	if !be.RequestTruncated || be.RequestSha == `` {
+		t.Errorf(`got truncated %t, sha %q, want true and a shape hash`, be.RequestTruncated, be.RequestSha)
+	}
+
+	re := &ReportEvent{BodiesEvent: be}
+	p := SanitizationProvider{
+		SensitiveKeys:    []*regexp.Regexp{DefaultSensitiveKeys},
+		SensitiveRegexps: []*regexp.Regexp{DefaultSensitiveData},
+	}
+	if err := p.SanitizeRequestBody(context.Background(), re); err != nil {
+		t.Fatalf(`SanitizeRequestBody() error: %v`, err)
+	}
+	form := re.RequestBody.(map[string]interface{})
+	if form[`password`] != Filtered {
+		t.Errorf(`got password %v, want %s`, form[`password`], Filtered)
+	}
+	if contact := form[`contact`].([]interface{})[0]; contact != Filtered {
+		t.Errorf(`got contact %v, want %s`, contact, Filtered)
+	}
+	file := form[`upload`].([]interface{})[0].(map[string]interface{})
+	if file[MultipartFileName] != `report.pdf` {
+		t.Errorf(`got file part %v, want report.pdf`, file)
+	}
+}
@@ -14,7 +14,7 @@ import (
 
 // RequestBodyParser is an events.Listener performing eager resBody loading on API
 // requests, to perform sanitization and bandwidth reduction.
-func (BodyParsingProvider) RequestBodyParser(_ context.Context, e events.Event) error {
+func (p BodyParsingProvider) RequestBodyParser(_ context.Context, e events.Event) error {
 	be, ok := e.(*BodiesEvent)
 	if !ok {
 		return fmt.Errorf(`topic BodiesEvent, got %T`, e)
@@ -36,16 +36,63 @@ func (BodyParsingProvider) RequestBodyParser(_ context.Context, e events.Event)
 		be.RequestBody = BodyUndecodable
 		return fmt.Errorf("error peeking body: %w", err)
 	}
+	// Decode the peeked copy only: the application still receives the
+	// encoded bytes.
+	maxSize := bodyReader.maximumSize()
+	declaredLength, partial := request.ContentLength, false
+	if encoding := request.Header.Get(ContentEncodingHeader); encoding != `` {
+		bodyBytes, partial, err = decodeBody(bodyBytes, encoding, err == io.EOF, maxSize)
+		if errors.Is(err, errUnsupportedEncoding) {
+			be.RequestBody = BodyIsBinary
+			return nil
+		}
+		if err != nil {
+			be.RequestBody = BodyUndecodable
+			return fmt.Errorf("decoding request body: %w", err)
+		}
+		// The declared length is the encoded one.
+		declaredLength = -1
+	}
+	// A body closed before its end was only partially captured.
+	incomplete := bodyReader.incomplete()
+	partial = partial || incomplete
 	reader := bytes.NewReader(bodyBytes)
 	if reader.Len() == 0 {
 		be.RequestBody = ``
+		if incomplete {
+			be.RequestBody = BodyPartial
+		}
+		return nil
+	}
+	ct := request.Header.Get(proxy.ContentTypeHeader)
+	// File parts are not reported, so multipart bodies are parsed whatever
+	// their size.
+	if MultipartContentType.MatchString(ct) {
+		complete := !partial && reader.Len() < maxSize
+		form, err := ParseMultipartFormData(bodyBytes, ct, complete)
+		if err != nil {
+			be.RequestBody = BodyUndecodable
+			return fmt.Errorf("decoding multipart request body: %w", err)
+		}
+		be.RequestBody, be.RequestSha = form, ToSha(form)
+		if !complete {
+			be.RequestTruncated = true
+			be.RequestLength = bodyLength(declaredLength, len(bodyBytes))
+		}
 		return nil
 	}
-	if reader.Len() >= MaximumBodySize {
+	if partial || reader.Len() >= maxSize {
 		be.RequestBody = BodyTooLong
+		if incomplete {
+			be.RequestBody = BodyPartial
+		}
+		if body, sha, ok := p.truncateBody(bodyBytes, ct); ok {
+			be.RequestBody, be.RequestSha = body, sha
+			be.RequestTruncated = true
+			be.RequestLength = bodyLength(declaredLength, len(bodyBytes))
+		}
 		return nil
 	}
-	ct := request.Header.Get(proxy.ContentTypeHeader)
 	if !ParsableContentType.MatchString(ct) {
 		be.RequestBody = BodyIsBinary
 		return nil
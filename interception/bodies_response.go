@@ -38,16 +38,63 @@ func (p BodyParsingProvider) ResponseBodyParser(_ context.Context, e events.Even
 		be.RequestBody = BodyUndecodable
 		return fmt.Errorf("error peeking body: %w", err)
 	}
+	// Decode the peeked copy only: the application still receives the
+	// encoded bytes.
+	maxSize := bodyReader.maximumSize()
+	declaredLength, partial := response.ContentLength, false
+	if encoding := response.Header.Get(ContentEncodingHeader); encoding != `` {
+		bodyBytes, partial, err = decodeBody(bodyBytes, encoding, err == io.EOF, maxSize)
+		if errors.Is(err, errUnsupportedEncoding) {
+			be.ResponseBody = BodyIsBinary
+			return nil
+		}
+		if err != nil {
+			be.ResponseBody = BodyUndecodable
+			return fmt.Errorf("decoding response body: %w", err)
+		}
+		// The declared length is the encoded one.
+		declaredLength = -1
+	}
+	// A body closed before its end was only partially captured.
+	incomplete := bodyReader.incomplete()
+	partial = partial || incomplete
 	reader := bytes.NewReader(bodyBytes)
 	if reader.Len() == 0 {
 		be.ResponseBody = ``
+		if incomplete {
+			be.ResponseBody = BodyPartial
+		}
+		return nil
+	}
+	ct := response.Header.Get(proxy.ContentTypeHeader)
+	// File parts are not reported, so multipart bodies are parsed whatever
+	// their size.
+	if MultipartContentType.MatchString(ct) {
+		complete := !partial && reader.Len() < maxSize
+		form, err := ParseMultipartFormData(bodyBytes, ct, complete)
+		if err != nil {
+			be.ResponseBody = BodyUndecodable
+			return fmt.Errorf("decoding multipart response body: %w", err)
+		}
+		be.ResponseBody, be.ResponseSha = form, ToSha(form)
+		if !complete {
+			be.ResponseTruncated = true
+			be.ResponseLength = bodyLength(declaredLength, len(bodyBytes))
+		}
 		return nil
 	}
-	if reader.Len() >= MaximumBodySize {
+	if partial || reader.Len() >= maxSize {
 		be.ResponseBody = BodyTooLong
+		if incomplete {
+			be.ResponseBody = BodyPartial
+		}
+		if body, sha, ok := p.truncateBody(bodyBytes, ct); ok {
+			be.ResponseBody, be.ResponseSha = body, sha
+			be.ResponseTruncated = true
+			be.ResponseLength = bodyLength(declaredLength, len(bodyBytes))
+		}
 		return nil
 	}
-	ct := response.Header.Get(proxy.ContentTypeHeader)
 	if !ParsableContentType.MatchString(ct) {
 		be.ResponseBody = BodyIsBinary
 		return nil
@@ -78,6 +78,29 @@ func TestBodyReadCloser(t *testing.T) {
 	}
 }
 
+func TestBodyReadCloser_Close(t *testing.T) {
+	reader := strings.NewReader(`0123456789`)
+	brc := NewBodyReadCloser(ioutil.NopCloser(reader), 8)
+	done := 0
+	brc.onDone = func() { done++ }
+
+	buffer := make([]byte, 3)
+	if n, err := brc.Read(buffer); n != 3 || err != nil {
+		t.Fatalf(`Read() = %d, %v, want 3 bytes`, n, err)
+	}
+	if reader.Len() != 7 {
+		t.Errorf(`Read() consumed %d bytes, want 3`, 10-reader.Len())
+	}
+	_ = brc.Close()
+	_ = brc.Close()
+	if done != 1 {
+		t.Errorf(`onDone called %d times, want 1`, done)
+	}
+	if peeked, err := brc.Peek(); string(peeked) != `012` || err != nil || !brc.incomplete() {
+		t.Errorf(`Peek() after Close() = %q, %v, want an incomplete prefix`, peeked, err)
+	}
+}
+
 func TestParseFormData(t *testing.T) {
 	tests := []struct {
 		name     string
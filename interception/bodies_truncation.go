@@ -0,0 +1,129 @@
+package interception
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// truncateBody builds the report value of a body too long to be parsed whole,
+// from its first TruncatedBodySize bytes, if truncation is enabled and the
+// content type is JSON or text.
+//
+// JSON bodies are decoded on a best-effort basis, keeping the values entirely
+// contained in the prefix, so that they can be sanitized and shape-hashed like
+// complete bodies. Text bodies are kept as a string, without their last word,
+// which may be cut, so that no part of a sensitive value escapes the detection
+// of the whole value.
+func (p BodyParsingProvider) truncateBody(bodyBytes []byte, ct string) (body interface{}, sha string, ok bool) {
+	size := p.TruncatedBodySize
+	if size <= 0 || !ParsableContentType.MatchString(ct) || FormContentType.MatchString(ct) {
+		return nil, ``, false
+	}
+	if size > len(bodyBytes) {
+		size = len(bodyBytes)
+	}
+	prefix := bodyBytes[:size]
+
+	if JSONContentType.MatchString(ct) {
+		body = decodeJSONPrefix(prefix)
+		if body == nil {
+			return nil, ``, false
+		}
+		return body, ToSha(body), true
+	}
+
+	return string(dropPartialWord(prefix)), ``, true
+}
+
+// dropPartialWord drops the last word of a text prefix, including any
+// incomplete rune, and the groups of digits separated by spaces or dashes
+// before it, which may be the start of a number cut in the middle, like a card
+// number.
+func dropPartialWord(prefix []byte) []byte {
+	prefix = prefix[:bytes.LastIndexFunc(prefix, unicode.IsSpace)+1]
+	for n := len(prefix); n > 0; n = len(prefix) {
+		c := prefix[n-1]
+		if !isDigit(c) && !((c == ' ' || c == '-') && n > 1 && isDigit(prefix[n-2])) {
+			break
+		}
+		prefix = prefix[:n-1]
+	}
+	return prefix
+}
+
+// isDigit checks whether c is an ASCII decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// decodeJSONPrefix decodes the prefix of a JSON document, keeping the values
+// entirely contained in the prefix, and the partial arrays and objects
+// containing them. It returns nil if no value could be decoded.
+//
+// A number at the very end of the prefix may be cut, so it is dropped.
+func decodeJSONPrefix(data []byte) interface{} {
+	data = bytes.TrimRightFunc(data, func(r rune) bool {
+		return strings.ContainsRune(`0123456789.eE+-`, r)
+	})
+	d := json.NewDecoder(bytes.NewReader(data))
+	v, _ := decodeJSONPrefixValue(d)
+	return v
+}
+
+// decodeJSONPrefixValue decodes the next JSON value from d. On error, it
+// returns the partial value decoded so far, if any, with the error.
+func decodeJSONPrefixValue(d *json.Decoder) (interface{}, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := make(map[string]interface{})
+		for d.More() {
+			keyTok, err := d.Token()
+			if err != nil {
+				return m, err
+			}
+			key, _ := keyTok.(string) // Object keys are always strings.
+			v, err := decodeJSONPrefixValue(d)
+			if v != nil || err == nil {
+				m[key] = v
+			}
+			if err != nil {
+				return m, err
+			}
+		}
+		_, err = d.Token()
+		return m, err
+
+	case json.Delim('['):
+		a := make([]interface{}, 0)
+		for d.More() {
+			v, err := decodeJSONPrefixValue(d)
+			if v != nil || err == nil {
+				a = append(a, v)
+			}
+			if err != nil {
+				return a, err
+			}
+		}
+		_, err = d.Token()
+		return a, err
+
+	default:
+		return tok, nil
+	}
+}
+
+// bodyLength returns the length of a body from its declared length, or from
+// the size of its peeked part if its declared length is unknown, in which case
+// it is a lower bound.
+func bodyLength(declared int64, peeked int) int64 {
+	if declared > 0 {
+		return declared
+	}
+	return int64(peeked)
+}
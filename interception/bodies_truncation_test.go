@@ -0,0 +1,165 @@
+package interception
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+func TestDecodeJSONPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   interface{}
+	}{
+		{`complete`, `{"a":[1,2]}`, map[string]interface{}{`a`: []interface{}{1.0, 2.0}}},
+		{`truncated string`, `{"a":1,"b":"hel`, map[string]interface{}{`a`: 1.0}},
+		{`truncated key`, `{"a":1,"b`, map[string]interface{}{`a`: 1.0}},
+		{`nested`, `[{"a":null,"b":[true,"x"`, []interface{}{map[string]interface{}{`a`: nil, `b`: []interface{}{true, `x`}}}},
+		{`nothing`, `"abc`, nil},
+		{`cut number`, `{"a":[1,2`, map[string]interface{}{`a`: []interface{}{1.0}}},
+		{`cut exponent`, `{"a":1,"b":1.5e`, map[string]interface{}{`a`: 1.0}},
+		{`cut card number`, `{"card":41111111`, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeJSONPrefix([]byte(tt.prefix)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf(`decodeJSONPrefix() = %#v, want %#v`, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropPartialWord(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{`word`, `hello wor`, `hello `},
+		{`whole words`, "hello world\n", "hello world\n"},
+		{`single word`, `hello`, ``},
+		{`incomplete rune`, "caf\xc3", ``},
+		{`cut card number`, `card 4111 1111 1111 11`, `card `},
+		{`cut dashed number`, `card 4111-1111-1111-11`, `card `},
+		{`digits before word`, `order 12 ite`, `order `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(dropPartialWord([]byte(tt.prefix))); got != tt.want {
+				t.Errorf(`dropPartialWord() = %q, want %q`, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyParsingProvider_TruncatedBodies(t *testing.T) {
+	longJSON := `{"password":"secret","items":[` + strings.Repeat(`"abcdef",`, MaximumBodySize/9) + `"z"]}`
+	longText := strings.Repeat(`é`, MaximumBodySize)
+	tests := []struct {
+		name          string
+		body          string
+		ct            string
+		truncatedSize int
+		wantTruncated bool
+		check         func(t *testing.T, body interface{}, sha string)
+	}{
+		{`disabled`, longText, `text/plain`, 0, false, func(t *testing.T, body interface{}, _ string) {
+			if body != BodyTooLong {
+				t.Errorf(`got body %v, want %s`, body, BodyTooLong)
+			}
+		}},
+		{`binary`, longText, `application/octet-stream`, 100, false, nil},
+		{`text`, strings.Repeat(`éé `, MaximumBodySize/5+1), `text/plain`, 11, true, func(t *testing.T, body interface{}, _ string) {
+			if body != `éé éé ` {
+				t.Errorf(`got body %q, want the 2 whole words`, body)
+			}
+		}},
+		{`JSON`, longJSON, proxy.ContentTypeJSON, 40, true, func(t *testing.T, body interface{}, sha string) {
+			want := map[string]interface{}{
+				`password`: `secret`,
+				`items`:    []interface{}{`abcdef`},
+			}
+			if !reflect.DeepEqual(body, want) {
+				t.Errorf(`got body %#v, want %#v`, body, want)
+			}
+			if sha != ToSha(want) {
+				t.Errorf(`got sha %s, want shape of the decoded prefix`, sha)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &BodiesEvent{}
+			res := &http.Response{
+				Header:        http.Header{proxy.ContentTypeHeader: {tt.ct}},
+				Body:          testReader(tt.body),
+				ContentLength: -1,
+			}
+			e.SetResponse(res)
+			p := BodyParsingProvider{TruncatedBodySize: tt.truncatedSize}
+			if err := p.ResponseBodyParser(context.Background(), e); err != nil {
+				t.Fatalf(`ResponseBodyParser() error: %v`, err)
+			}
+			if e.ResponseTruncated != tt.wantTruncated {
+				t.Fatalf(`got truncated %t, want %t`, e.ResponseTruncated, tt.wantTruncated)
+			}
+			if tt.wantTruncated && e.ResponseLength != MaximumBodySize+1 {
+				t.Errorf(`got length %d, want lower bound %d`, e.ResponseLength, MaximumBodySize+1)
+			}
+			if tt.check != nil {
+				tt.check(t, e.ResponseBody, e.ResponseSha)
+			}
+			// The application still reads the whole body.
+			if b, _ := ioutil.ReadAll(res.Body); len(b) != len(tt.body) {
+				t.Errorf(`application read %d bytes, want %d`, len(b), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestBodyParsingProvider_PartialBodies(t *testing.T) {
+	tests := []struct {
+		name          string
+		read          int
+		truncatedSize int
+		wantBody      interface{}
+		wantTruncated bool
+	}{
+		{`closed unread`, 0, 0, BodyPartial, false},
+		{`closed early`, 6, 0, BodyPartial, false},
+		{`closed early truncated`, 6, 100, "first\n", true},
+		{`read whole`, -1, 0, "first\nsecond\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := testReader("first\nsecond\n")
+			if tt.read < 0 {
+				_, _ = ioutil.ReadAll(body)
+			} else {
+				_, _ = io.ReadFull(body, make([]byte, tt.read))
+			}
+			_ = body.Close()
+			e := &BodiesEvent{}
+			e.SetResponse(&http.Response{
+				Header:        http.Header{proxy.ContentTypeHeader: {`text/plain`}},
+				Body:          body,
+				ContentLength: -1,
+			})
+			p := BodyParsingProvider{TruncatedBodySize: tt.truncatedSize}
+			if err := p.ResponseBodyParser(context.Background(), e); err != nil {
+				t.Fatalf(`ResponseBodyParser() error: %v`, err)
+			}
+			if e.ResponseBody != tt.wantBody || e.ResponseTruncated != tt.wantTruncated {
+				t.Errorf(`got body %q, truncated %t, want %q, %t`,
+					e.ResponseBody, e.ResponseTruncated, tt.wantBody, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package interception
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+// Call holds the state of an instrumented API call made without the
+// RoundTripper or the Handler, like a gRPC call, across its Bearer stages. The
+// call is represented as the HTTP exchange carrying it.
+type Call struct {
+	rt        *RoundTripper
+	ctx       context.Context
+	request   *http.Request
+	prevEvent APIEvent
+	t0        time.Time
+}
+
+// BeginCall runs the connect and request stages of an API call, using the
+// RoundTripper configuration. It returns an error if these stages fail, in
+// which case the call must not be performed, except in FailOpen mode, where the
+// call is performed without instrumentation.
+//
+// The request is kept by the Call, so its Body may be set once known, before
+// the call ends.
+func (rt *RoundTripper) BeginCall(ctx context.Context, request *http.Request) (*Call, error) {
+	c := &Call{rt: rt, ctx: ctx, request: request, t0: time.Now()}
+
+	var err error
+	if c.prevEvent, err = rt.stageConnect(ctx, request.URL); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageConnect, err)
+			c.prevEvent = nil
+			return c, nil
+		}
+		c.report(NewReportEvent(proxy.StageConnect, err), time.Now())
+		return nil, err
+	}
+	if c.prevEvent, err = rt.stageRequest(c.prevEvent, request); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageRequest, err)
+			c.prevEvent = nil
+			return c, nil
+		}
+		c.report(NewReportEvent(proxy.StageRequest, err), time.Now())
+		return nil, err
+	}
+	c.t0 = time.Now()
+	return c, nil
+}
+
+// IsActive checks whether the call is instrumented. Inactive calls need not be
+// ended.
+func (c *Call) IsActive() bool {
+	return c.prevEvent != nil
+}
+
+// MaximumBodySize returns the largest body size to store whole for the call.
+func (c *Call) MaximumBodySize() int {
+	return c.rt.maximumBodySize(c.prevEvent)
+}
+
+// report dispatches the ReportEvent of the call, if it is active. Events
+// without a request are completed with the call request and its last event.
+func (c *Call) report(rev *ReportEvent, t1 time.Time) {
+	if rev == nil || c.prevEvent == nil {
+		return
+	}
+	if rev.Request() == nil {
+		rev.SetRequest(c.request)
+		rev.SetConfig(c.prevEvent.Config())
+		rev.SetTriggeredDataCollectionRules(c.prevEvent.TriggeredDataCollectionRules())
+	}
+	if !rev.Config().IsActive {
+		return
+	}
+	rev.T0, rev.T1 = c.t0, t1
+	_, _ = c.rt.Dispatch(c.ctx, rev)
+}
+
+// Fail reports an active call which failed without a response, like calls
+// failing to connect.
+func (c *Call) Fail(err error) {
+	if c.prevEvent == nil {
+		return
+	}
+	c.report(NewReportEvent(proxy.StageRequest, err), time.Now())
+}
+
+// End runs the response and bodies stages of an active call, and reports it.
+// The bodies of the request and the response, if any, must be BodyReadCloser
+// values.
+func (c *Call) End(response *http.Response) {
+	t1 := time.Now()
+	if c.prevEvent == nil {
+		return
+	}
+	maxSize := c.MaximumBodySize()
+	prevEvent, err := c.rt.stageResponse(c.ctx, c.prevEvent, c.request, response, nil)
+	if err != nil {
+		if c.rt.FailOpen {
+			c.rt.diagnose(proxy.StageResponse, err)
+			err = nil
+		}
+		rev := NewReportEvent(proxy.StageResponse, err)
+		rev.SetRequest(c.request).SetResponse(response)
+		rev.SetConfig(prevEvent.Config())
+		rev.SetTriggeredDataCollectionRules(prevEvent.TriggeredDataCollectionRules())
+		c.report(rev, t1)
+		return
+	}
+	// Rules triggered by the response may only lower the limit, since the
+	// bodies were captured with the previous one.
+	if size := c.rt.maximumBodySize(prevEvent); size < maxSize {
+		if body, ok := response.Body.(*BodyReadCloser); ok {
+			body.setMaximumSize(size)
+		}
+	}
+	rev := c.rt.stageBodies(c.ctx, prevEvent, c.request, response, nil)
+	c.rt.divert(rev)
+	c.report(rev, t1)
+}
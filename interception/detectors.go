@@ -0,0 +1,243 @@
+package interception
+
+import (
+	"math/big"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The names of the built-in Detector values.
+const (
+	DetectorCard        = `card`
+	DetectorIBAN        = `iban`
+	DetectorSSN         = `ssn`
+	DetectorPhone       = `phone`
+	DetectorIPv4        = `ipv4`
+	DetectorIPv6        = `ipv6`
+	DetectorJWT         = `jwt`
+	DetectorAWSKey      = `aws-key`
+	DetectorGCPKey      = `gcp-key`
+	DetectorStripeKey   = `stripe-key`
+	DetectorBearerToken = `bearer-token`
+)
+
+// Detector finds a kind of sensitive data in strings, like payment card
+// numbers. Unlike sensitive regexps, it may validate the candidate matches of
+// its Regexp, to avoid false positives.
+type Detector struct {
+	Name   string
+	Regexp *regexp.Regexp
+
+	// Valid, if not nil, checks whether a match of the Regexp is actually
+	// sensitive, like IBANs with a valid checksum.
+	Valid func(match string) bool
+
+	// Find, if not nil, returns the index pairs of the sensitive parts of a
+	// match of the Regexp, like the card numbers in a run of digits. It takes
+	// precedence over Valid.
+	Find func(match string) [][]int
+}
+
+// ReplaceAll returns a copy of s in which the valid matches of the Detector are
+// replaced by the result of redact applied to them.
+func (d *Detector) ReplaceAll(s string, redact func(string) string) string {
+	return d.Regexp.ReplaceAllStringFunc(s, func(match string) string {
+		if d.Find != nil {
+			var b strings.Builder
+			last := 0
+			for _, loc := range d.Find(match) {
+				b.WriteString(match[last:loc[0]])
+				b.WriteString(redact(match[loc[0]:loc[1]]))
+				last = loc[1]
+			}
+			b.WriteString(match[last:])
+			return b.String()
+		}
+		if d.Valid != nil && !d.Valid(match) {
+			return match
+		}
+		return redact(match)
+	})
+}
+
+// detectors is the catalog of built-in Detector values, by name.
+var detectors = map[string]*Detector{
+	DetectorCard: {
+		Name: DetectorCard,
+		// Runs of digit groups of any length, in which findCards locates the
+		// actual card numbers.
+		Regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,}\b`),
+		Find:   findCards,
+	},
+	DetectorIBAN: {
+		Name:   DetectorIBAN,
+		Regexp: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+		Valid:  isIBANValid,
+	},
+	DetectorSSN: {
+		Name:   DetectorSSN,
+		Regexp: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Valid:  isSSNValid,
+	},
+	DetectorPhone: {
+		Name: DetectorPhone,
+		// International numbers, and North American ones with separators.
+		Regexp: regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d+\)?){1,5}|\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b`),
+		Valid: func(match string) bool {
+			n := len(digits(match))
+			return n >= 7 && n <= 15
+		},
+	},
+	DetectorIPv4: {
+		Name:   DetectorIPv4,
+		Regexp: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		Valid: func(match string) bool {
+			return net.ParseIP(match) != nil
+		},
+	},
+	DetectorIPv6: {
+		Name:   DetectorIPv6,
+		Regexp: regexp.MustCompile(`(?i)\b[0-9a-f]{1,4}(?::[0-9a-f]{0,4}){2,7}\b`),
+		Valid: func(match string) bool {
+			return net.ParseIP(match) != nil
+		},
+	},
+	DetectorJWT: {
+		Name:   DetectorJWT,
+		Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	DetectorAWSKey: {
+		Name:   DetectorAWSKey,
+		Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	DetectorGCPKey: {
+		Name:   DetectorGCPKey,
+		Regexp: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+	},
+	DetectorStripeKey: {
+		Name:   DetectorStripeKey,
+		Regexp: regexp.MustCompile(`\b(?:sk|pk|rk)_(?:live|test)_[0-9A-Za-z]{10,99}\b`),
+	},
+	DetectorBearerToken: {
+		Name:   DetectorBearerToken,
+		Regexp: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`),
+	},
+}
+
+// DetectorByName returns the built-in Detector with the given name, or nil if
+// there is none.
+func DetectorByName(name string) *Detector {
+	return detectors[name]
+}
+
+// DetectorNames returns the sorted names of the built-in Detector values.
+func DetectorNames() []string {
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// digits returns the decimal digits in s.
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// findCards returns the index pairs of the card numbers in a run of digit
+// groups separated by spaces or dashes: the spans of consecutive groups with 13
+// to 19 digits in total and a valid Luhn checksum. Overlapping candidates are
+// merged, so that a valid number is never left out next to other digits.
+func findCards(run string) [][]int {
+	groups := digitGroups.FindAllStringIndex(run, -1)
+	covered := make([]bool, len(groups))
+	for first := range groups {
+		number := ``
+		for last := first; last < len(groups); last++ {
+			number += run[groups[last][0]:groups[last][1]]
+			if len(number) > 19 {
+				break
+			}
+			if isLuhnValid(number) {
+				for i := first; i <= last; i++ {
+					covered[i] = true
+				}
+			}
+		}
+	}
+	var locs [][]int
+	for i := 0; i < len(groups); i++ {
+		if !covered[i] {
+			continue
+		}
+		j := i
+		for j+1 < len(groups) && covered[j+1] {
+			j++
+		}
+		locs = append(locs, []int{groups[i][0], groups[j][1]})
+		i = j
+	}
+	return locs
+}
+
+// digitGroups matches the groups of consecutive digits in card numbers.
+var digitGroups = regexp.MustCompile(`\d+`)
+
+// isLuhnValid checks whether a card number of 13 to 19 digits, without
+// separators, has a valid Luhn checksum.
+func isLuhnValid(ds string) bool {
+	if len(ds) < 13 || len(ds) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range ds {
+		d := int(ds[len(ds)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// isIBANValid checks whether an IBAN, possibly with spaces, has a valid
+// ISO 13616 mod 97 checksum.
+func isIBANValid(iban string) bool {
+	iban = strings.Replace(iban, ` `, ``, -1)
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// Move the country code and check digits to the end, and convert the
+	// letters to numbers, A being 10.
+	var b strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			b.WriteString(big.NewInt(int64(r - 'A' + 10)).String())
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && n.Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// isSSNValid checks whether a US Social Security Number in AAA-GG-SSSS format
+// uses assignable area, group, and serial numbers.
+func isSSNValid(ssn string) bool {
+	area, group, serial := ssn[0:3], ssn[4:6], ssn[7:11]
+	return area != `000` && area != `666` && area[0] != '9' && group != `00` && serial != `0000`
+}
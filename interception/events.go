@@ -47,6 +47,10 @@ const (
 type APIEventConfig struct {
 	IsActive bool
 	LogLevel
+
+	// SampleRate is the rate at which the API call was sampled, or 0 if it was
+	// not sampled.
+	SampleRate float64
 }
 
 // APIEvent is the type common to all API call lifecycle events.
@@ -146,6 +150,14 @@ type BodiesEvent struct {
 	apiEvent
 	RequestBody, ResponseBody interface{}
 	RequestSha, ResponseSha   string
+
+	// RequestTruncated and ResponseTruncated are true if the bodies only
+	// contain a prefix of the actual bodies.
+	RequestTruncated, ResponseTruncated bool
+
+	// RequestLength and ResponseLength are the actual lengths of truncated
+	// bodies, or a lower bound of it if it is not declared.
+	RequestLength, ResponseLength int64
 }
 
 // ReportEvent is emitted to publish a call proxy.ReportLog.
@@ -153,6 +165,21 @@ type ReportEvent struct {
 	*BodiesEvent
 	proxy.Stage
 	T0, T1 time.Time
+
+	// Direction is proxy.Outbound for API calls made by the application, and
+	// proxy.Inbound for API calls served by it.
+	Direction string
+
+	// TraceContext identifies the span of the API call in a distributed
+	// trace, if it is known.
+	TraceContext TraceContext
+
+	// Timing is the phase breakdown of outbound HTTP API calls.
+	Timing *Timing
+
+	// Hijacked is true for served API calls whose connection was taken over
+	// by the handler, like WebSocket upgrades: their response is unknown.
+	Hijacked bool
 }
 
 // Topic is part of the Event interface.
@@ -173,6 +200,7 @@ func NewReportEvent(stage proxy.Stage, err error) *ReportEvent {
 	return &ReportEvent{
 		BodiesEvent: be,
 		Stage:       stage,
+		Direction:   proxy.Outbound,
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"regexp"
 	"testing"
 
 	"github.com/bearer/go-agent/filters"
@@ -331,3 +332,44 @@ func TestProxyProvider_onReport(t *testing.T) {
 		})
 	}
 }
+
+// panickingRedactor is a Redactor with a bug.
+type panickingRedactor struct{}
+
+func (panickingRedactor) Redact(string) string {
+	panic(`redactor bug`)
+}
+
+func TestProxyProvider_FailClosed(t *testing.T) {
+	stubLogger := zerolog.New(ioutil.Discard)
+	sender := &proxy.Sender{
+		Logger: &stubLogger,
+		FanIn:  make(chan proxy.ReportLog, 3),
+	}
+	dispatcher := events.NewDispatcher(
+		events.WithPanicLimit(1),
+		events.WithFailClosed(TopicReport),
+	).AddProviders(TopicReport,
+		SanitizationProvider{
+			SensitiveKeys: []*regexp.Regexp{DefaultSensitiveKeys},
+			Redactors: map[string]Redactor{
+				DefaultSensitiveKeys.String(): panickingRedactor{},
+			},
+		},
+		ProxyProvider{Sender: sender},
+	)
+
+	for i := 0; i < 3; i++ {
+		rev := NewReportEvent(proxy.StageBodies, nil)
+		req, _ := http.NewRequest(http.MethodGet, `https://example.com/`, nil)
+		req.Header.Set(`Authorization`, `Bearer secret`)
+		rev.SetRequest(req)
+		rev.SetConfig(&APIEventConfig{IsActive: true})
+		if _, err := dispatcher.Dispatch(context.Background(), rev); err == nil {
+			t.Fatalf(`dispatch %d succeeded, want it to fail closed`, i)
+		}
+	}
+	if n := len(sender.FanIn); n != 0 {
+		t.Errorf(`%d unsanitized reports reached the ProxyProvider`, n)
+	}
+}
@@ -0,0 +1,48 @@
+package interception
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// gRPC calls are instrumented by the grpcagent package, and reported as the
+// HTTP/2 exchanges carrying them, with these conventions.
+const (
+	// GRPCScheme is the URL scheme of the requests representing gRPC calls.
+	GRPCScheme = `grpc`
+
+	// GRPCContentType is the content type of gRPC messages.
+	GRPCContentType = `application/grpc`
+
+	// GRPCJSONContentType is the content type of gRPC messages in their JSON
+	// representation, which is used to report protobuf messages.
+	GRPCJSONContentType = `application/grpc+json`
+
+	// GRPCStatusHeader is the canonical header name of the gRPC status code.
+	GRPCStatusHeader = `Grpc-Status`
+
+	// GRPCMessageHeader is the canonical header name of the gRPC status message.
+	GRPCMessageHeader = `Grpc-Message`
+)
+
+// grpcStatusNames are the names of the gRPC status codes, by value, as
+// defined by the gRPC specification.
+var grpcStatusNames = []string{
+	`OK`, `Canceled`, `Unknown`, `InvalidArgument`, `DeadlineExceeded`,
+	`NotFound`, `AlreadyExists`, `PermissionDenied`, `ResourceExhausted`,
+	`FailedPrecondition`, `Aborted`, `OutOfRange`, `Unimplemented`, `Internal`,
+	`Unavailable`, `DataLoss`, `Unauthenticated`,
+}
+
+// GRPCStatusName returns the name of the gRPC status code in the Grpc-Status
+// header of a response, or an empty string if there is none.
+func GRPCStatusName(header http.Header) string {
+	code, err := strconv.Atoi(header.Get(GRPCStatusHeader))
+	if err != nil {
+		return ``
+	}
+	if code < 0 || code >= len(grpcStatusNames) {
+		return `Code(` + strconv.Itoa(code) + `)`
+	}
+	return grpcStatusNames[code]
+}
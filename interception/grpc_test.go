@@ -0,0 +1,30 @@
+package interception
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGRPCStatusName(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{``, ``},
+		{`0`, `OK`},
+		{`5`, `NotFound`},
+		{`16`, `Unauthenticated`},
+		{`17`, `Code(17)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			header := http.Header{}
+			if tt.status != `` {
+				header.Set(GRPCStatusHeader, tt.status)
+			}
+			if got := GRPCStatusName(header); got != tt.want {
+				t.Errorf(`GRPCStatusName() = %q, want %q`, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package interception
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/proxy"
+)
+
+// Handler is the instrumented implementation of http.Handler, for the API
+// calls served by the application.
+//
+// It triggers the same events as the RoundTripper, at the same stages, but
+// its ReportEvent Direction is proxy.Inbound. Failures of the Bearer stages
+// never prevent the Underlying handler from serving the request, and the
+// stages following the handling run asynchronously, so that they do not delay
+// the response.
+type Handler struct {
+	events.Dispatcher
+	Underlying http.Handler
+
+	// MaximumBodySize is the largest body size to store whole, as in
+	// RoundTripper.
+	MaximumBodySize int
+
+	// PropagateTraceContext enables the creation of a W3C Trace Context span
+	// for each served request, continuing the trace of the caller, if any. The
+	// span is available to the Underlying handler in the request context, so
+	// that the outbound requests it makes with that context belong to the same
+	// trace.
+	PropagateTraceContext bool
+
+	// FailOpen and Diagnostics divert the errors of the Bearer stages, as in
+	// RoundTripper, so that served requests are not reported as failed
+	// because of agent errors.
+	FailOpen    bool
+	Diagnostics Diagnoser
+}
+
+// stages returns a RoundTripper sharing the Handler configuration, to run the
+// Bearer stages.
+func (h *Handler) stages() *RoundTripper {
+	return &RoundTripper{
+		Dispatcher:      h.Dispatcher,
+		MaximumBodySize: h.MaximumBodySize,
+		FailOpen:        h.FailOpen,
+		Diagnostics:     h.Diagnostics,
+	}
+}
+
+// inboundRequest returns a shallow copy of an incoming request, with an
+// absolute URL, as expected by the Bearer stages.
+func inboundRequest(r *http.Request) *http.Request {
+	request := r.WithContext(r.Context())
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = `http`
+	if r.TLS != nil {
+		u.Scheme = `https`
+	}
+	request.URL = &u
+	return request
+}
+
+// responseRecorder is a http.ResponseWriter capturing the status, headers,
+// and the first bytes of the body of the responses it writes.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	statusCode int
+	header     http.Header
+
+	// body is the captured part of the response body, at most peekSize bytes.
+	body     bytes.Buffer
+	peekSize int
+	// written is the number of body bytes actually written.
+	written int64
+	// hijacked is set once the connection was taken over by the handler, so
+	// the response is not known.
+	hijacked bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.statusCode == 0 {
+		rr.statusCode = statusCode
+		rr.header = rr.Header().Clone()
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.statusCode == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	if remaining := rr.peekSize - rr.body.Len(); remaining > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		rr.body.Write(p[:remaining])
+	}
+	rr.written += int64(n)
+	return n, err
+}
+
+// Flush implements the http.Flusher interface, if the underlying
+// http.ResponseWriter supports it.
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		if rr.statusCode == 0 {
+			rr.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface, if the underlying
+// http.ResponseWriter supports it.
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", rr.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		rr.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Push implements the http.Pusher interface, if the underlying
+// http.ResponseWriter supports it.
+func (rr *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	p, ok := rr.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// writerOnly hides the optional interfaces of an io.Writer, so that io.Copy
+// uses its Write method.
+type writerOnly struct {
+	io.Writer
+}
+
+// ReadFrom implements the io.ReaderFrom interface, capturing the first body
+// bytes before handing the rest over to the underlying http.ResponseWriter,
+// so that it may still use optimizations like sendfile.
+func (rr *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := rr.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{rr}, src)
+	}
+	if rr.statusCode == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	var n int64
+	if remaining := int64(rr.peekSize - rr.body.Len()); remaining > 0 {
+		var err error
+		n, err = io.Copy(writerOnly{rr}, io.LimitReader(src, remaining))
+		if err != nil || n < remaining {
+			return n, err
+		}
+	}
+	m, err := rf.ReadFrom(src)
+	rr.written += m
+	return n + m, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for the
+// http.ResponseController.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// response builds the http.Response written through the recorder, with a
+// body limited to its captured part. The status of hijacked connections on
+// which nothing was written is left 0.
+func (rr *responseRecorder) response(request *http.Request) *http.Response {
+	statusCode, header := rr.statusCode, rr.header
+	if statusCode == 0 {
+		header = rr.Header().Clone()
+		if !rr.hijacked {
+			// Nothing was written: the server sends an empty 200 response.
+			statusCode = http.StatusOK
+		}
+	}
+	status := ``
+	if statusCode != 0 {
+		status = fmt.Sprintf(`%d %s`, statusCode, http.StatusText(statusCode))
+	}
+	return &http.Response{
+		Status:        status,
+		StatusCode:    statusCode,
+		Proto:         request.Proto,
+		ProtoMajor:    request.ProtoMajor,
+		ProtoMinor:    request.ProtoMinor,
+		Header:        header,
+		Body:          NewBodyReadCloser(ioutil.NopCloser(&rr.body), rr.peekSize),
+		ContentLength: rr.written,
+		TLS:           request.TLS,
+		Request:       request,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var prevEvent APIEvent
+	var err error
+	var rev *ReportEvent
+	var (
+		// Ensure valid timestamps even on early returns.
+		t0 = time.Now()
+		t1 = t0
+	)
+
+	var tc TraceContext
+	if h.PropagateTraceContext {
+		tc = inboundTraceContext(r)
+		r = r.WithContext(ContextWithTraceContext(r.Context(), tc))
+	}
+	ctx := r.Context()
+	request := inboundRequest(r)
+	rt := h.stages()
+
+	hijacked := false
+	report := func(ctx context.Context, rev *ReportEvent) {
+		if rev == nil || !rev.Config().IsActive {
+			return
+		}
+		rev.T0 = t0
+		// If the t1 reset was not reached, use the time spent in the agent.
+		if t1 == t0 {
+			t1 = time.Now()
+		}
+		rev.T1 = t1
+		rev.Direction = proxy.Inbound
+		rev.TraceContext = tc
+		rev.Hijacked = hijacked
+		_, _ = h.Dispatch(ctx, rev)
+	}
+	defer func() {
+		report(ctx, rev)
+	}()
+
+	if prevEvent, err = rt.stageConnect(ctx, request.URL); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageConnect, err)
+			h.Underlying.ServeHTTP(w, r)
+			return
+		}
+		rev = NewReportEvent(proxy.StageConnect, err)
+		rev.SetRequest(request)
+		rev.SetConfig(prevEvent.Config())
+		rev.SetTriggeredDataCollectionRules(prevEvent.TriggeredDataCollectionRules())
+		h.Underlying.ServeHTTP(w, r)
+		return
+	}
+
+	if prevEvent, err = rt.stageRequest(prevEvent, request); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageRequest, err)
+			h.Underlying.ServeHTTP(w, r)
+			return
+		}
+		rev = NewReportEvent(proxy.StageRequest, err)
+		rev.SetRequest(request)
+		rev.SetConfig(prevEvent.Config())
+		rev.SetTriggeredDataCollectionRules(prevEvent.TriggeredDataCollectionRules())
+		h.Underlying.ServeHTTP(w, r)
+		return
+	}
+	if prevEvent == nil {
+		// The agent is not active.
+		h.Underlying.ServeHTTP(w, r)
+		return
+	}
+
+	maxSize := rt.maximumBodySize(prevEvent)
+	if r.Body != nil {
+		request.Body = NewBodyReadCloser(r.Body, maxSize+1)
+		r.Body = request.Body
+	}
+	recorder := &responseRecorder{ResponseWriter: w, peekSize: maxSize + 1}
+
+	// Perform and time the underlying handling.
+	t0 = time.Now()
+	h.Underlying.ServeHTTP(recorder, r)
+	t1 = time.Now()
+	// Only report the request body bytes read by the handler: reading the
+	// rest would delay the response of requests rejected without reading
+	// their body, like oversized uploads.
+	if body, ok := request.Body.(*BodyReadCloser); ok {
+		body.detach(request.ContentLength)
+	}
+
+	response := recorder.response(request)
+	hijacked = recorder.hijacked
+
+	// Everything is captured: do not delay the response with the remaining
+	// stages and the report, and do not fail them when the request context
+	// ends with the response.
+	go func() {
+		ctx := reportContext{ctx}
+		report(ctx, rt.finishInbound(ctx, prevEvent, request, response, maxSize))
+	}()
+}
+
+// finishInbound runs the response and bodies stages of a served API call, whose
+// body was captured with the maxSize limit, and returns its ReportEvent.
+func (rt *RoundTripper) finishInbound(ctx context.Context, prevEvent APIEvent, request *http.Request, response *http.Response, maxSize int) *ReportEvent {
+	prevEvent, err := rt.stageResponse(ctx, prevEvent, request, response, nil)
+	if err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageResponse, err)
+			err = nil
+		}
+		rev := NewReportEvent(proxy.StageResponse, err)
+		rev.SetRequest(request).SetResponse(response)
+		rev.SetConfig(prevEvent.Config())
+		rev.SetTriggeredDataCollectionRules(prevEvent.TriggeredDataCollectionRules())
+		return rev
+	}
+
+	// Rules triggered by the response may only lower the limit, since the
+	// body was captured with the previous one.
+	if size := rt.maximumBodySize(prevEvent); size < maxSize {
+		response.Body.(*BodyReadCloser).setMaximumSize(size)
+	}
+
+	rev := rt.stageBodies(ctx, prevEvent, request, response, nil)
+	rt.divert(rev)
+	return rev
+}
@@ -0,0 +1,316 @@
+package interception
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/proxy"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int
+		body        string
+		wantRequest interface{}
+		wantBody    interface{}
+	}{
+		{`happy`, 0, `{"name":"request"}`,
+			map[string]interface{}{`name`: `request`}, map[string]interface{}{`echo`: `{"name":"request"}`}},
+		{`too long`, 8, `{"name":"request"}`, BodyTooLong, BodyTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			h := &Handler{
+				Dispatcher:      dispatcher,
+				MaximumBodySize: tt.maxSize,
+				Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, err := ioutil.ReadAll(r.Body)
+					if err != nil || string(body) != tt.body {
+						t.Errorf(`handler read %q, %v, want %q`, body, err, tt.body)
+					}
+					w.Header().Set(proxy.ContentTypeHeader, proxy.ContentTypeJSON)
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{"echo":`))
+					_, _ = w.Write([]byte(`"` + strings.ReplaceAll(string(body), `"`, `\"`) + `"}`))
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, `/path?q=1`, strings.NewReader(tt.body))
+			req.Header.Set(proxy.ContentTypeHeader, proxy.ContentTypeJSON)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != http.StatusCreated || !strings.HasPrefix(w.Body.String(), `{"echo":`) {
+				t.Errorf(`unexpected response %d %s`, w.Code, w.Body)
+			}
+			got := waitReports(reports, 1)
+			if len(got) != 1 {
+				t.Fatal(`no report event dispatched`)
+			}
+			rev := got[0]
+			if rev.Direction != proxy.Inbound || rev.Stage != proxy.StageBodies {
+				t.Errorf(`report direction/stage = %s/%s, want %s/%s`,
+					rev.Direction, rev.Stage, proxy.Inbound, proxy.StageBodies)
+			}
+			if u := rev.Request().URL.String(); u != `http://example.com/path?q=1` {
+				t.Errorf(`report URL = %s`, u)
+			}
+			if code := rev.Response().StatusCode; code != http.StatusCreated {
+				t.Errorf(`report status = %d, want %d`, code, http.StatusCreated)
+			}
+			if !reflect.DeepEqual(rev.RequestBody, tt.wantRequest) {
+				t.Errorf(`report request body = %#v, want %#v`, rev.RequestBody, tt.wantRequest)
+			}
+			if !reflect.DeepEqual(rev.ResponseBody, tt.wantBody) {
+				t.Errorf(`report response body = %#v, want %#v`, rev.ResponseBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandler_FailOpen(t *testing.T) {
+	failure := errors.New(`listener failure`)
+	tests := []struct {
+		name      string
+		topic     events.Topic
+		failOpen  bool
+		wantStage proxy.Stage
+	}{
+		{`connect`, TopicConnect, true, proxy.StageConnect},
+		{`request`, TopicRequest, true, proxy.StageRequest},
+		{`response`, TopicResponse, true, proxy.StageResponse},
+		{`bodies`, TopicBodies, true, proxy.StageBodies},
+		{`fail closed`, TopicBodies, false, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			dispatcher.AddProviders(tt.topic, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+				return []events.Listener{func(context.Context, events.Event) error {
+					return failure
+				}}
+			}))
+			diagnostics := &testDiagnoser{}
+			h := &Handler{
+				Dispatcher: dispatcher,
+				Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusAccepted)
+				}),
+				FailOpen:    tt.failOpen,
+				Diagnostics: diagnostics,
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, `/path`, nil))
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf(`served status = %d, want %d`, w.Code, http.StatusAccepted)
+			}
+			// The response and bodies stages run asynchronously, and are
+			// always reported.
+			if tt.topic == TopicResponse || tt.topic == TopicBodies {
+				waitReports(reports, 1)
+			}
+			if !tt.failOpen {
+				if len(reports()) != 1 || !errors.Is(reports()[0].Error, failure) || len(diagnostics.stages) != 0 {
+					t.Fatalf(`got reports %v, diagnostics %v, want the listener failure reported`, reports(), diagnostics.stages)
+				}
+				return
+			}
+			if !reflect.DeepEqual(diagnostics.stages, []proxy.Stage{tt.wantStage}) {
+				t.Errorf(`diagnosed stages = %v, want %s`, diagnostics.stages, tt.wantStage)
+			}
+			for _, rev := range reports() {
+				if rev.Error != nil {
+					t.Errorf(`reported API call error = %v, want none`, rev.Error)
+				}
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read from its Reader.
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestHandler_ServeHTTP_UnreadRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		read        func(r *http.Request) error
+		wantRead    int
+		wantRequest interface{}
+	}{
+		{`rejected unread`, func(*http.Request) error { return nil }, 0, BodyPartial},
+		{`decoded value`, func(r *http.Request) error {
+			var v interface{}
+			return json.NewDecoder(r.Body).Decode(&v)
+		}, len(`{"name":"request"}`), map[string]interface{}{`name`: `request`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			dispatcher.AddProviders(TopicBodies, BodyParsingProvider{})
+			h := &Handler{
+				Dispatcher: dispatcher,
+				Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if err := tt.read(r); err != nil {
+						t.Errorf(`handler read error: %v`, err)
+					}
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				}),
+			}
+			body := &countingReader{Reader: strings.NewReader(`{"name":"request"}`)}
+			req := httptest.NewRequest(http.MethodPost, `/upload`, body)
+			req.Header.Set(proxy.ContentTypeHeader, proxy.ContentTypeJSON)
+			req.ContentLength = int64(len(`{"name":"request"}`))
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if body.n != tt.wantRead {
+				t.Errorf(`read %d request body bytes, want %d`, body.n, tt.wantRead)
+			}
+			if len(waitReports(reports, 1)) != 1 {
+				t.Fatalf(`got %d reports, want 1`, len(reports()))
+			}
+			if got := reports()[0].RequestBody; !reflect.DeepEqual(got, tt.wantRequest) {
+				t.Errorf(`report request body = %#v, want %#v`, got, tt.wantRequest)
+			}
+		})
+	}
+}
+
+func TestHandler_Hijack(t *testing.T) {
+	reports := make(chan *ReportEvent, 1)
+	dispatcher := events.NewDispatcher()
+	dispatcher.AddProviders(TopicBodies, BodyParsingProvider{})
+	dispatcher.AddProviders(TopicReport, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+		return []events.Listener{func(_ context.Context, e events.Event) error {
+			reports <- e.(*ReportEvent)
+			return nil
+		}}
+	}))
+	server := httptest.NewServer(&Handler{
+		Dispatcher: dispatcher,
+		Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf(`Hijack() error: %v`, err)
+				return
+			}
+			_ = conn.Close()
+		}),
+	})
+	defer server.Close()
+
+	if res, err := http.Get(server.URL); err == nil {
+		_ = res.Body.Close()
+	}
+	rev := <-reports
+	if !rev.Hijacked {
+		t.Error(`report not marked as hijacked`)
+	}
+	ll := LogLevelFromString(`ALL`)
+	if rl := ll.Prepare(rev); !rl.Hijacked || rl.StatusCode != 0 {
+		t.Errorf(`report log hijacked/status = %t/%d, want true/0`, rl.Hijacked, rl.StatusCode)
+	}
+}
+
+// testOptionalWriter is a http.ResponseWriter implementing the optional
+// io.ReaderFrom and http.Pusher interfaces.
+type testOptionalWriter struct {
+	*httptest.ResponseRecorder
+	readFrom int64
+	pushed   []string
+}
+
+func (w *testOptionalWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseRecorder, src)
+	w.readFrom += n
+	return n, err
+}
+
+func (w *testOptionalWriter) Push(target string, _ *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestResponseRecorder_OptionalInterfaces(t *testing.T) {
+	w := &testOptionalWriter{ResponseRecorder: httptest.NewRecorder()}
+	rr := &responseRecorder{ResponseWriter: w, peekSize: 4}
+
+	if err := rr.Push(`/style.css`, nil); err != nil || !reflect.DeepEqual(w.pushed, []string{`/style.css`}) {
+		t.Errorf(`Push() = %v, pushed %v`, err, w.pushed)
+	}
+	n, err := rr.ReadFrom(strings.NewReader(`0123456789`))
+	if err != nil || n != 10 {
+		t.Fatalf(`ReadFrom() = %d, %v, want 10, nil`, n, err)
+	}
+	if w.Body.String() != `0123456789` || w.readFrom != 6 {
+		t.Errorf(`underlying body = %q, %d bytes through ReadFrom, want all and 6`, w.Body, w.readFrom)
+	}
+	if rr.body.String() != `0123` || rr.written != 10 {
+		t.Errorf(`captured %q, %d bytes written, want "0123", 10`, rr.body.String(), rr.written)
+	}
+	if rr.Unwrap() != w {
+		t.Error(`Unwrap() does not return the underlying writer`)
+	}
+
+	plain := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	if err := plain.Push(`/style.css`, nil); err != http.ErrNotSupported {
+		t.Errorf(`Push() on a plain writer = %v, want %v`, err, http.ErrNotSupported)
+	}
+}
+
+func TestHandler_AsynchronousReport(t *testing.T) {
+	release := make(chan struct{})
+	reports := make(chan *ReportEvent, 1)
+	dispatcher := events.NewDispatcher()
+	dispatcher.AddProviders(TopicBodies, BodyParsingProvider{})
+	dispatcher.AddProviders(TopicReport, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+		return []events.Listener{func(_ context.Context, e events.Event) error {
+			<-release
+			reports <- e.(*ReportEvent)
+			return nil
+		}}
+	}))
+	h := &Handler{
+		Dispatcher: dispatcher,
+		Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(proxy.ContentTypeHeader, `text/plain`)
+			_, _ = w.Write([]byte(`hello`))
+		}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// Serving does not wait for the report listeners.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/path`, nil).WithContext(ctx))
+	// The end of the request context does not fail the report.
+	cancel()
+	close(release)
+
+	select {
+	case rev := <-reports:
+		if rev.Error != nil || rev.ResponseBody != `hello` {
+			t.Errorf(`reported error %v, body %q, want none, "hello"`, rev.Error, rev.ResponseBody)
+		}
+	case <-time.After(time.Second):
+		t.Error(`no report dispatched`)
+	}
+}
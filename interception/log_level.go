@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/bearer/go-agent/proxy"
@@ -16,16 +17,22 @@ import (
 type ContextKey string
 
 const (
-	// BodyTooLong is the replacement string for bodies beyond MaximumBodySize.
+	// BodyTooLong is the replacement string for bodies too long to be captured.
 	BodyTooLong = `(omitted due to size)`
 
+	// BodyPartial is the replacement string for bodies the application closed
+	// before reading them whole, like responses abandoned early, or request
+	// bodies a handler did not read: only their prefix read by the
+	// application is captured, and reported if truncated bodies are enabled.
+	BodyPartial = `(not fully read)`
+
 	// BodyIsBinary is the replacement string for unparseable bodies.
 	BodyIsBinary = `(not showing binary data)`
 
 	// BodyUndecodable is the replacement string for bodies which were expected to be parsable but failed decoding.
 	BodyUndecodable = `(could not decode data)`
 
-	// MaximumBodySize is the largest resBody size to store whole.
+	// MaximumBodySize is the default largest body size to store whole.
 	MaximumBodySize = 1 << 20
 )
 
@@ -41,6 +48,10 @@ var JSONContentType = regexp.MustCompile(`(?i)json`)
 // FormContentType is a regexp definint the content types to handle as traditional web forms.
 var FormContentType = regexp.MustCompile(`(?i)x-www-form-urlencoded`)
 
+// MultipartContentType is a regexp defining the content types to handle as
+// multipart forms.
+var MultipartContentType = regexp.MustCompile(`(?i)multipart/form-data`)
+
 // LogLevel represents the log levels defined by the Bearer platform.
 type LogLevel int
 
@@ -91,12 +102,24 @@ func (ll *LogLevel) addDetectedInfo(rl *proxy.ReportLog, re *ReportEvent) {
 		"socks5": 1080,
 	}
 	port := PortMap[u.Scheme] // Having 0 in case of errors is expected.
+	if explicit, err := strconv.ParseUint(u.Port(), 10, 16); err == nil {
+		port = uint16(explicit)
+	}
 
 	// The Agent spec specifies errors are not part of the minimal Detected level report.
 	rl.Hostname = u.Hostname()
 	rl.LogLevel = strings.ToUpper(ll.String())
+	rl.Direction = re.Direction
+	if re.TraceContext.IsValid() {
+		rl.TraceID = re.TraceContext.TraceID
+		rl.SpanID = re.TraceContext.SpanID
+		rl.ParentSpanID = re.TraceContext.ParentSpanID
+	}
 	rl.Port = port
 	rl.Protocol = u.Scheme
+	if response := re.Response(); response != nil {
+		rl.TLS = proxy.NewReportTLS(response.TLS)
+	}
 }
 
 // addRestrictedInfo adds to the report the info reported at the "RESTRICTED" log level.
@@ -115,6 +138,9 @@ func (ll *LogLevel) addRestrictedInfo(rl *proxy.ReportLog, re *ReportEvent) {
 
 	rl.StartedAt = int(re.T0.UnixNano() / 1E6)
 	rl.EndedAt = int(re.T1.UnixNano() / 1E6)
+	if re.Timing != nil {
+		rl.Timings = re.Timing.report(re.T0)
+	}
 	rl.Stage = string(re.Stage)
 	rl.ActiveDataCollectionRules = &triggeredRules
 	rl.Path = u.Path
@@ -123,8 +149,15 @@ func (ll *LogLevel) addRestrictedInfo(rl *proxy.ReportLog, re *ReportEvent) {
 	if response != nil {
 		rl.StatusCode = response.StatusCode
 	}
+	rl.Hijacked = re.Hijacked
 	rl.ErrorCode = errorCode
 	rl.ErrorFullMessage = errorMessage
+	if u.Scheme == GRPCScheme {
+		rl.GRPCMethod = u.Path
+		if response != nil {
+			rl.GRPCStatus = GRPCStatusName(response.Header)
+		}
+	}
 
 	if err != nil {
 		rl.Type = proxy.Error
@@ -140,6 +173,10 @@ func (ll *LogLevel) addAllInfo(rl *proxy.ReportLog, re *ReportEvent) {
 	rl.RequestHeaders = request.Header
 	rl.RequestBodyPayloadSHA = re.RequestSha
 	rl.RequestBody = serializeBody(rl.RequestHeaders, re.RequestBody)
+	if re.RequestTruncated {
+		rl.RequestBodyTruncated = true
+		rl.RequestBodyLength = re.RequestLength
+	}
 	if re.RequestBody != nil && rl.RequestBody == `` {
 		rl.RequestBody = `(no body)`
 	}
@@ -151,6 +188,10 @@ func (ll *LogLevel) addAllInfo(rl *proxy.ReportLog, re *ReportEvent) {
 	rl.ResponseHeaders = response.Header
 	rl.ResponseBodyPayloadSHA = re.ResponseSha
 	rl.ResponseBody = serializeBody(rl.ResponseHeaders, re.ResponseBody)
+	if re.ResponseTruncated {
+		rl.ResponseBodyTruncated = true
+		rl.ResponseBodyLength = re.ResponseLength
+	}
 	if re.ResponseBody != nil && rl.ResponseBody == `` {
 		rl.ResponseBody = `(no body)`
 	}
@@ -164,6 +205,9 @@ func (ll *LogLevel) Prepare(re *ReportEvent) proxy.ReportLog {
 	}
 
 	rl := proxy.ReportLog{}
+	if config := re.Config(); config != nil {
+		rl.SampleRate = config.SampleRate
+	}
 	ll.addDetectedInfo(&rl, re)
 
 	if *ll >= Restricted {
@@ -1,6 +1,7 @@
 package interception
 
 import (
+	"crypto/tls"
 	"io"
 	"net/http"
 	"testing"
@@ -28,6 +29,36 @@ func TestLogLevelFromString(t *testing.T) {
 	}
 }
 
+func TestLogLevel_addDetectedInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   *tls.ConnectionState
+		wantTLS bool
+	}{
+		{`happy TLS`, &tls.ConnectionState{Version: tls.VersionTLS12}, true},
+		{`happy plain`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewReportEvent(proxy.StageConnect, nil)
+			req, _ := http.NewRequest(http.MethodGet, defaultTestURL, nil)
+			e.SetRequest(req)
+			e.SetResponse(&http.Response{TLS: tt.state})
+			rl := proxy.ReportLog{}
+			level := Detected
+			level.addDetectedInfo(&rl, e)
+
+			if (rl.TLS != nil) != tt.wantTLS {
+				t.Fatalf(`addDetectedInfo TLS: %+v, want TLS %t`, rl.TLS, tt.wantTLS)
+			}
+			if tt.wantTLS && rl.TLS.Version != `TLS 1.2` {
+				t.Errorf(`addDetectedInfo TLS version: %s, want TLS 1.2`, rl.TLS.Version)
+			}
+		})
+	}
+}
+
 func TestLogLevel_addRestrictedInfo(t *testing.T) {
 	tests := []struct {
 		name     string
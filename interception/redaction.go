@@ -0,0 +1,88 @@
+package interception
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMask is the character replacing masked characters.
+const DefaultMask = '*'
+
+// Redactor provides a redaction strategy, replacing the sensitive values found
+// by the SanitizationProvider in reports.
+type Redactor interface {
+	Redact(value string) string
+}
+
+// ReplaceRedactor replaces values with a fixed string, Filtered by default.
+type ReplaceRedactor struct {
+	Replacement string
+}
+
+// Redact implements the Redactor interface.
+func (r ReplaceRedactor) Redact(string) string {
+	if r.Replacement == `` {
+		return Filtered
+	}
+	return r.Replacement
+}
+
+// KeepLastRedactor masks values except for their last N characters, like
+// ************1234 for a card number. Values not longer than N are masked
+// entirely, and a negative N is handled as 0.
+type KeepLastRedactor struct {
+	N int
+	// Mask is the masking character, DefaultMask if zero.
+	Mask rune
+}
+
+// Redact implements the Redactor interface.
+func (r KeepLastRedactor) Redact(value string) string {
+	keep := r.N
+	if keep < 0 {
+		keep = 0
+	}
+	n := utf8.RuneCountInString(value)
+	if n <= keep {
+		return MaskRedactor{Mask: r.Mask}.Redact(value)
+	}
+	runes := []rune(value)
+	return strings.Repeat(string(mask(r.Mask)), n-keep) + string(runes[n-keep:])
+}
+
+// MaskRedactor masks every character of values, preserving their length.
+type MaskRedactor struct {
+	// Mask is the masking character, DefaultMask if zero.
+	Mask rune
+}
+
+// Redact implements the Redactor interface.
+func (r MaskRedactor) Redact(value string) string {
+	return strings.Repeat(string(mask(r.Mask)), utf8.RuneCountInString(value))
+}
+
+// HMACRedactor replaces values with a keyed hash of them, so that equal values
+// can be correlated across reports without being disclosed. Without the key,
+// the hash does not allow guessing values, even from small sets like card
+// numbers.
+type HMACRedactor struct {
+	Key []byte
+}
+
+// Redact implements the Redactor interface.
+func (r HMACRedactor) Redact(value string) string {
+	mac := hmac.New(sha256.New, r.Key)
+	_, _ = mac.Write([]byte(value))
+	return `[HMAC:` + hex.EncodeToString(mac.Sum(nil)[:16]) + `]`
+}
+
+// mask returns the masking character, defaulting to DefaultMask.
+func mask(r rune) rune {
+	if r == 0 {
+		return DefaultMask
+	}
+	return r
+}
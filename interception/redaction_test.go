@@ -0,0 +1,57 @@
+package interception_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bearer/go-agent/interception"
+)
+
+func TestRedactors(t *testing.T) {
+	key := []byte(`secret key`)
+	tests := []struct {
+		name     string
+		redactor interception.Redactor
+		value    string
+		want     string
+	}{
+		{`replace default`, interception.ReplaceRedactor{}, `4111111111111111`, interception.Filtered},
+		{`replace custom`, interception.ReplaceRedactor{Replacement: `[CARD]`}, `4111111111111111`, `[CARD]`},
+		{`keep last`, interception.KeepLastRedactor{N: 4}, `4111111111111111`, `************1111`},
+		{`keep last negative`, interception.KeepLastRedactor{N: -1}, `abcd`, `****`},
+		{`keep last custom mask`, interception.KeepLastRedactor{N: 2, Mask: 'x'}, `été!`, `xxé!`},
+		{`keep last short value`, interception.KeepLastRedactor{N: 4}, `123`, `***`},
+		{`mask`, interception.MaskRedactor{}, `été`, `***`},
+		{`mask empty`, interception.MaskRedactor{}, ``, ``},
+		{`hmac`, interception.HMACRedactor{Key: key}, `4111111111111111`, `[HMAC:`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.redactor.Redact(tt.value)
+			if _, ok := tt.redactor.(interception.HMACRedactor); ok {
+				if !strings.HasPrefix(got, tt.want) || strings.Contains(got, tt.value) {
+					t.Errorf("Redact() = %s, want a hash", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Redact() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHMACRedactor_Redact(t *testing.T) {
+	r := interception.HMACRedactor{Key: []byte(`secret key`)}
+	other := interception.HMACRedactor{Key: []byte(`other key`)}
+	const card = `4111111111111111`
+	if r.Redact(card) != r.Redact(card) {
+		t.Error("equal values have different hashes")
+	}
+	if r.Redact(card) == r.Redact(`4111111111111112`) {
+		t.Error("different values have the same hash")
+	}
+	if r.Redact(card) == other.Redact(card) {
+		t.Error("different keys give the same hash")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -17,9 +18,100 @@ import (
 // RoundTripper is the instrumented implementation of http.RoundTripper.
 //
 // It triggers events for the TopicConnect, TopicRequest, and TopicResponse stages.
+//
+// For responses with a body, the TopicBodies stage and the report are deferred
+// until the application reads the body to its end or closes it.
 type RoundTripper struct {
 	events.Dispatcher
 	Underlying http.RoundTripper
+
+	// MaximumBodySize is the largest body size to store whole. If zero, the
+	// MaximumBodySize constant applies. It may be overridden per API call by
+	// the MaximumBodySizeParam of the triggered DataCollectionRules.
+	MaximumBodySize int
+
+	// PropagateTraceContext enables the injection of W3C Trace Context headers
+	// in requests not already carrying them.
+	PropagateTraceContext bool
+
+	// FailOpen diverts the errors of the Bearer stages, like listener failures,
+	// to the Diagnostics, so that RoundTrip always returns the response and
+	// error of the Underlying transport.
+	FailOpen bool
+
+	// Diagnostics, if not nil, records the errors diverted in FailOpen mode.
+	Diagnostics Diagnoser
+}
+
+// Diagnoser records internal agent errors, which are not errors of the API
+// calls during which they happen. It is implemented by proxy.Sender.
+type Diagnoser interface {
+	Diagnose(stage proxy.Stage, err error)
+}
+
+// diagnose records an internal agent error. The cancellation of an API call
+// is not one.
+func (rt *RoundTripper) diagnose(stage proxy.Stage, err error) {
+	if rt.Diagnostics == nil || err == nil ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	rt.Diagnostics.Diagnose(stage, err)
+}
+
+// divert removes the error of the bodies stage from its ReportEvent in
+// FailOpen mode, recording it as an internal agent error.
+func (rt *RoundTripper) divert(rev *ReportEvent) {
+	if !rt.FailOpen || rev == nil || rev.Error == nil {
+		return
+	}
+	rt.diagnose(proxy.StageBodies, rev.Error)
+	rev.Error = nil
+}
+
+// reportContext is a context.Context carrying the values of an API call
+// context, but not its deadline nor its cancellation, for the stages run after
+// the call.
+type reportContext struct {
+	context.Context
+}
+
+// Deadline implements the context.Context interface.
+func (reportContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements the context.Context interface.
+func (reportContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err implements the context.Context interface.
+func (reportContext) Err() error {
+	return nil
+}
+
+// MaximumBodySizeParam is the DataCollectionRule.Params key holding the
+// largest body size to store whole for the API calls triggering the rule, as a
+// non-negative number of bytes.
+const MaximumBodySizeParam = `maximumBodySize`
+
+// maximumBodySize returns the largest body size to store whole for an API
+// call: the MaximumBodySizeParam of the last triggered DataCollectionRule
+// defining it, if any, or else the RoundTripper MaximumBodySize.
+func (rt *RoundTripper) maximumBodySize(e APIEvent) int {
+	if e != nil {
+		rules := e.TriggeredDataCollectionRules()
+		for i := len(rules) - 1; i >= 0; i-- {
+			if size, ok := rules[i].Params[MaximumBodySizeParam].(float64); ok && size >= 0 {
+				return int(size)
+			}
+		}
+	}
+	if rt.MaximumBodySize > 0 {
+		return rt.MaximumBodySize
+	}
+	return MaximumBodySize
 }
 
 // schemeRegexp is the regular expression matching the RFC3986 grammar
@@ -112,6 +204,11 @@ func (rt *RoundTripper) stageRequest(prevEvent APIEvent, request *http.Request)
 	if err = ctx.Err(); err != nil {
 		return be, err
 	}
+	// Listeners, like sampling, may deactivate the call: it is then neither
+	// captured nor reported.
+	if !be.Config().IsActive {
+		return nil, nil
+	}
 
 	return be, nil
 }
@@ -168,15 +265,19 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	var prevEvent APIEvent
 	var err error
 	var rev *ReportEvent
+	var response *http.Response
 	var (
 		// Ensure valid timestamps even on early returns.
 		t0 = time.Now()
 		t1 = t0
 	)
 
+	request, tc := outboundTraceContext(request, rt.PropagateTraceContext)
 	ctx := request.Context()
+	// timing is only set for the calls to report, once they are known.
+	var timing *Timing
 
-	defer func() {
+	report := func(ctx context.Context, rev *ReportEvent) {
 		if rev == nil || !rev.Config().IsActive {
 			return
 		}
@@ -186,10 +287,24 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 			t1 = time.Now()
 		}
 		rev.T1 = t1
+		rev.TraceContext = tc
+		if response != nil && timing != nil {
+			if body, ok := response.Body.(*BodyReadCloser); ok {
+				timing.BodyDone = body.completionTime()
+			}
+		}
+		rev.Timing = timing
 		_, _ = rt.Dispatch(ctx, rev)
+	}
+	defer func() {
+		report(ctx, rev)
 	}()
 
 	if prevEvent, err = rt.stageConnect(ctx, request.URL); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageConnect, err)
+			return rt.Underlying.RoundTrip(request)
+		}
 		rev = NewReportEvent(proxy.StageConnect, err)
 		rev.SetRequest(request)
 		rev.SetConfig(prevEvent.Config())
@@ -198,6 +313,10 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	}
 
 	if prevEvent, err = rt.stageRequest(prevEvent, request); err != nil {
+		if rt.FailOpen {
+			rt.diagnose(proxy.StageRequest, err)
+			return rt.Underlying.RoundTrip(request)
+		}
 		rev = NewReportEvent(proxy.StageRequest, err)
 		rev.SetRequest(request)
 		rev.SetConfig(prevEvent.Config())
@@ -205,8 +324,13 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		return nil, err
 	}
 
-	if request.Body != nil {
-		request.Body = NewBodyReadCloser(request.Body, MaximumBodySize+1)
+	// Inactive calls have no event, and are neither timed nor captured.
+	if prevEvent != nil {
+		timing = &Timing{}
+		request = request.WithContext(httptrace.WithClientTrace(ctx, timing.ClientTrace()))
+		if request.Body != nil {
+			request.Body = NewBodyReadCloser(request.Body, rt.maximumBodySize(prevEvent)+1)
+		}
 	}
 
 	// Perform and time the underlying API call, without resBody capture.
@@ -214,8 +338,8 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	response, rtErr := rt.Underlying.RoundTrip(request)
 	t1 = time.Now()
 
-	if response != nil && response.Body != nil {
-		response.Body = NewBodyReadCloser(response.Body, MaximumBodySize+1)
+	if response != nil && response.Body != nil && prevEvent != nil {
+		response.Body = NewBodyReadCloser(response.Body, rt.maximumBodySize(prevEvent)+1)
 	}
 
 	if prevEvent, err = rt.stageResponse(ctx, prevEvent, request, response, rtErr); err != nil {
@@ -223,6 +347,11 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		if response == nil {
 			stage = proxy.StageRequest
 		}
+		// Errors other than the transport one come from the listeners.
+		if rt.FailOpen && err != rtErr {
+			rt.diagnose(stage, err)
+			err = rtErr
+		}
 		rev = NewReportEvent(stage, err)
 		rev.SetRequest(request).SetResponse(response)
 		rev.SetConfig(prevEvent.Config())
@@ -230,8 +359,42 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		return rev.Response(), err
 	}
 
+	// Rules triggered by the response may change the limit, since the body
+	// has not been peeked yet.
+	if response != nil {
+		if body, ok := response.Body.(*BodyReadCloser); ok {
+			body.setMaximumSize(rt.maximumBodySize(prevEvent))
+		}
+	}
+
+	// Defer the bodies stage and the report of responses with a body until
+	// the application is done with it, so that it may consume it incrementally,
+	// as with streaming responses.
+	if response != nil && response.ContentLength != 0 && prevEvent != nil && prevEvent.Config().IsActive {
+		if body, ok := response.Body.(*BodyReadCloser); ok {
+			body.onDone = func() {
+				// Report copies, since listeners replace fields like the
+				// headers while the application may still use the originals.
+				req, res := *request, *response
+				if res.Request == request {
+					res.Request = &req
+				}
+				// Do not delay the Read or Close of the application, and do
+				// not fail the report if the call context ends meanwhile.
+				go func() {
+					ctx := reportContext{ctx}
+					rev := rt.stageBodies(ctx, prevEvent, &req, &res, err)
+					rt.divert(rev)
+					report(ctx, rev)
+				}()
+			}
+			return response, rtErr
+		}
+	}
+
 	rev = rt.stageBodies(ctx, prevEvent, request, response, err)
-	if rev == nil {
+	rt.divert(rev)
+	if rev == nil || rt.FailOpen {
 		return response, rtErr
 	}
 	return rev.Response(), rev.Err()
@@ -1,16 +1,21 @@
 package interception
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bearer/go-agent/events"
+	"github.com/bearer/go-agent/proxy"
 )
 
 const defaultTestURL = `http://localhost:80`
@@ -106,3 +111,244 @@ func TestRoundTripper_RoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestRoundTripper_maximumBodySize(t *testing.T) {
+	small := DataCollectionRule{Params: map[string]interface{}{MaximumBodySizeParam: 1024.0}}
+	invalid := DataCollectionRule{Params: map[string]interface{}{MaximumBodySizeParam: -1.0}}
+	plain := DataCollectionRule{}
+	tests := []struct {
+		name  string
+		size  int
+		rules []*DataCollectionRule
+		want  int
+	}{
+		{`default`, 0, nil, MaximumBodySize},
+		{`agent`, 4096, nil, 4096},
+		{`rule`, 4096, []*DataCollectionRule{&small, &plain}, 1024},
+		{`invalid rule`, 4096, []*DataCollectionRule{&invalid}, 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &RoundTripper{MaximumBodySize: tt.size}
+			u, _ := url.Parse(defaultTestURL)
+			e := NewConnectEvent(u)
+			e.SetTriggeredDataCollectionRules(tt.rules)
+			if got := rt.maximumBodySize(e); got != tt.want {
+				t.Errorf("maximumBodySize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripper_StreamingBody(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `text/plain`)
+		_, _ = w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			_, _ = w.Write([]byte("second\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		readAll  bool
+		wantBody string
+	}{
+		{`read to the end`, true, "first\nsecond\n"},
+		{`closed early`, false, BodyPartial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			client := &http.Client{Transport: &RoundTripper{
+				Dispatcher: dispatcher,
+				Underlying: http.DefaultTransport,
+			}}
+			res, err := client.Get(ts.URL)
+			if err != nil {
+				t.Fatalf(`Get() error = %v`, err)
+			}
+			// The first line is available before the end of the body.
+			line, err := bufio.NewReader(res.Body).ReadString('\n')
+			if err != nil || line != "first\n" {
+				t.Fatalf(`ReadString() = %q, %v, want the first line`, line, err)
+			}
+			if len(reports()) != 0 {
+				t.Fatalf(`got %d reports before the end of the body, want 0`, len(reports()))
+			}
+
+			if tt.readAll {
+				release <- struct{}{}
+				_, _ = ioutil.ReadAll(res.Body)
+			}
+			_ = res.Body.Close()
+			_ = res.Body.Close()
+
+			if got := waitReports(reports, 1); len(got) != 1 {
+				t.Fatalf(`got %d reports, want 1`, len(got))
+			}
+			rev := reports()[0]
+			if rev.ResponseBody != tt.wantBody {
+				t.Errorf(`reported body = %q, want %q`, rev.ResponseBody, tt.wantBody)
+			}
+			if bodyDone := rev.Timing.report(rev.T0).BodyDone; (bodyDone > 0) != tt.readAll {
+				t.Errorf(`reported body done after %f ms, want a duration: %t`, bodyDone, tt.readAll)
+			}
+		})
+	}
+}
+
+func TestRoundTripper_AsynchronousReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`hello`))
+	}))
+	defer ts.Close()
+
+	release := make(chan struct{})
+	reports := make(chan *ReportEvent, 1)
+	dispatcher := events.NewDispatcher()
+	dispatcher.AddProviders(TopicBodies, BodyParsingProvider{})
+	dispatcher.AddProviders(TopicReport, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+		return []events.Listener{func(_ context.Context, e events.Event) error {
+			<-release
+			reports <- e.(*ReportEvent)
+			return nil
+		}}
+	}))
+	client := &http.Client{Transport: &RoundTripper{
+		Dispatcher: dispatcher,
+		Underlying: http.DefaultTransport,
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf(`Do() error = %v`, err)
+	}
+	// Reading and closing the body do not wait for the report listeners.
+	_, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	// Ending the call context afterwards does not fail the report.
+	cancel()
+	close(release)
+
+	select {
+	case rev := <-reports:
+		if rev.Error != nil || rev.ResponseBody != `hello` {
+			t.Errorf(`reported error %v, body %q, want none, "hello"`, rev.Error, rev.ResponseBody)
+		}
+	case <-time.After(time.Second):
+		t.Error(`no report dispatched`)
+	}
+}
+
+// testReportRecorder returns a dispatcher parsing bodies and recording the
+// ReportEvent events, and a function returning them.
+func testReportRecorder() (events.Dispatcher, func() []*ReportEvent) {
+	var m sync.Mutex
+	var reports []*ReportEvent
+	dispatcher := events.NewDispatcher()
+	dispatcher.AddProviders(TopicBodies, BodyParsingProvider{})
+	dispatcher.AddProviders(TopicReport, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+		return []events.Listener{func(_ context.Context, e events.Event) error {
+			m.Lock()
+			defer m.Unlock()
+			reports = append(reports, e.(*ReportEvent))
+			return nil
+		}}
+	}))
+	return dispatcher, func() []*ReportEvent {
+		m.Lock()
+		defer m.Unlock()
+		return reports
+	}
+}
+
+// waitReports waits up to a second for n reports to be recorded, since
+// responses with a body are reported asynchronously, and returns them.
+func waitReports(reports func() []*ReportEvent, n int) []*ReportEvent {
+	deadline := time.Now().Add(time.Second)
+	for len(reports()) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return reports()
+}
+
+// testDiagnoser is a Diagnoser recording the stages of the diverted errors.
+type testDiagnoser struct {
+	m      sync.Mutex
+	stages []proxy.Stage
+}
+
+func (d *testDiagnoser) Diagnose(stage proxy.Stage, _ error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.stages = append(d.stages, stage)
+}
+
+func TestRoundTripper_FailOpen(t *testing.T) {
+	failure := errors.New(`listener failure`)
+	tests := []struct {
+		name      string
+		topic     events.Topic
+		panics    bool
+		failOpen  bool
+		wantStage proxy.Stage
+	}{
+		{`connect`, TopicConnect, false, true, proxy.StageConnect},
+		{`request`, TopicRequest, false, true, proxy.StageRequest},
+		{`response`, TopicResponse, false, true, proxy.StageResponse},
+		{`bodies`, TopicBodies, false, true, proxy.StageBodies},
+		{`bodies panic`, TopicBodies, true, true, proxy.StageBodies},
+		{`fail closed`, TopicBodies, false, false, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, reports := testReportRecorder()
+			dispatcher.AddProviders(tt.topic, events.ListenerProviderFunc(func(events.Event) []events.Listener {
+				return []events.Listener{func(context.Context, events.Event) error {
+					if tt.panics {
+						panic(failure)
+					}
+					return failure
+				}}
+			}))
+			want := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+			diagnostics := &testDiagnoser{}
+			rt := &RoundTripper{
+				Dispatcher: dispatcher,
+				Underlying: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+					want.Request = request
+					return want, nil
+				}),
+				FailOpen:    tt.failOpen,
+				Diagnostics: diagnostics,
+			}
+			req, _ := http.NewRequest(http.MethodGet, defaultTestURL, nil)
+			got, err := rt.RoundTrip(req)
+
+			if !tt.failOpen {
+				if !errors.Is(err, failure) || len(diagnostics.stages) != 0 {
+					t.Fatalf(`RoundTrip() error = %v, diagnostics %v, want the listener failure`, err, diagnostics.stages)
+				}
+				return
+			}
+			if got != want || err != nil {
+				t.Fatalf(`RoundTrip() = %v, %v, want the underlying response`, got, err)
+			}
+			if !reflect.DeepEqual(diagnostics.stages, []proxy.Stage{tt.wantStage}) {
+				t.Errorf(`diagnosed stages = %v, want %s`, diagnostics.stages, tt.wantStage)
+			}
+			for _, rev := range reports() {
+				if rev.Error != nil {
+					t.Errorf(`reported API call error = %v, want none`, rev.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package interception
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/bearer/go-agent/events"
+)
+
+// SampleRateParam is the DataCollectionRule.Params key holding the rate at
+// which the API calls triggering the rule are reported, as a number in the
+// [0, 1] interval.
+const SampleRateParam = `sampleRate`
+
+// SampleRecorder is the interface used by the SamplingProvider to count the
+// sampled out API calls, like the proxy.Sender.
+type SampleRecorder interface {
+	SampleOut(host string)
+}
+
+// SamplingProvider is an events.ListenerProvider returning a listener sampling
+// API calls at the request stage, before their bodies are captured.
+//
+// Sampling is deterministic: with a rate r, exactly one in every 1/r API calls
+// sharing the same rate source is reported, the other ones being deactivated,
+// so that their bodies are neither captured nor parsed, and counted as sampled
+// out by the Recorder.
+//
+// The rate of an API call is the SampleRateParam of the last DataCollectionRule
+// triggered up to the request stage defining it, if any, or else its entry in
+// HostRates, if any, or else Rate.
+type SamplingProvider struct {
+	// Rate is the default sampling rate, in the [0, 1] interval.
+	Rate float64
+
+	// HostRates are the sampling rates of specific hosts, overriding Rate.
+	HostRates map[string]float64
+
+	// Recorder, if not nil, counts the sampled out API calls.
+	Recorder SampleRecorder
+
+	m sync.Mutex
+	// counters hold the number of API calls seen per rate source.
+	counters map[string]uint64
+}
+
+// NewSamplingProvider builds a SamplingProvider reporting sampled out API
+// calls to recorder.
+func NewSamplingProvider(rate float64, hostRates map[string]float64, recorder SampleRecorder) *SamplingProvider {
+	return &SamplingProvider{
+		Rate:      rate,
+		HostRates: hostRates,
+		Recorder:  recorder,
+	}
+}
+
+// IsValidSampleRate checks whether a sampling rate is in the [0, 1] interval.
+func IsValidSampleRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
+
+// rate returns the sampling rate for an APIEvent, and the key of the counter
+// for its rate source.
+func (p *SamplingProvider) rate(e APIEvent) (float64, string) {
+	rules := e.TriggeredDataCollectionRules()
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rate, ok := rules[i].Params[SampleRateParam].(float64); ok && IsValidSampleRate(rate) {
+			return rate, `rule:` + rules[i].Signature
+		}
+	}
+	host := e.Request().URL.Hostname()
+	if rate, ok := p.HostRates[host]; ok {
+		return rate, `host:` + host
+	}
+	return p.Rate, ``
+}
+
+// keep checks whether the next API call for the counter key must be reported.
+func (p *SamplingProvider) keep(key string, rate float64) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.counters == nil {
+		p.counters = make(map[string]uint64)
+	}
+	n := p.counters[key]
+	p.counters[key] = n + 1
+	return math.Floor(float64(n+1)*rate) > math.Floor(float64(n)*rate)
+}
+
+// Sample is the listener applying sampling to RequestEvent events. It
+// deactivates sampled out API calls and stops the dispatch of their events,
+// and records the rate in the configuration of the others.
+func (p *SamplingProvider) Sample(_ context.Context, e events.Event) error {
+	ae, ok := e.(APIEvent)
+	if !ok {
+		return fmt.Errorf("topic %s used with non-APIEvent type %T", e.Topic(), e)
+	}
+	config := ae.Config()
+	if ae.Request() == nil || config == nil || !config.IsActive {
+		return nil
+	}
+	rate, key := p.rate(ae)
+	if rate >= 1 {
+		return nil
+	}
+	if !p.keep(key, rate) {
+		config.IsActive = false
+		if p.Recorder != nil {
+			p.Recorder.SampleOut(ae.Request().URL.Hostname())
+		}
+		return events.DispatchStopRequest
+	}
+	config.SampleRate = rate
+	return nil
+}
+
+// Listeners implements the events.ListenerProvider interface.
+func (p *SamplingProvider) Listeners(e events.Event) []events.Listener {
+	if e.Topic() != TopicRequest {
+		return nil
+	}
+	return []events.Listener{p.Sample}
+}
@@ -0,0 +1,124 @@
+package interception
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bearer/go-agent/events"
+)
+
+// testSampleRecorder is a SampleRecorder counting sampled out calls per host.
+type testSampleRecorder struct {
+	m     sync.Mutex
+	hosts map[string]int
+}
+
+func (r *testSampleRecorder) SampleOut(host string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]int)
+	}
+	r.hosts[host]++
+}
+
+func (r *testSampleRecorder) total() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	total := 0
+	for _, n := range r.hosts {
+		total += n
+	}
+	return total
+}
+
+func TestSamplingProvider_Sample(t *testing.T) {
+	sampled := DataCollectionRule{
+		Params:    map[string]interface{}{SampleRateParam: 0.25},
+		Signature: `sampled`,
+	}
+	unsampled := DataCollectionRule{Signature: `unsampled`}
+	tests := []struct {
+		name     string
+		url      string
+		rules    []*DataCollectionRule
+		wantKept int
+		wantRate float64
+	}{
+		{`default rate`, `http://example.com/`, nil, 5, 0.5},
+		{`host rate`, `http://full.example.com/`, nil, 10, 0},
+		{`rule rate`, `http://example.com/`, []*DataCollectionRule{&sampled, &unsampled}, 2, 0.25},
+		{`rule without rate`, `http://zero.example.com/`, []*DataCollectionRule{&unsampled}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &testSampleRecorder{}
+			p := NewSamplingProvider(0.5, map[string]float64{
+				`full.example.com`: 1,
+				`zero.example.com`: 0,
+			}, recorder)
+			kept := 0
+			for i := 0; i < 10; i++ {
+				e := &RequestEvent{}
+				req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+				e.SetRequest(req)
+				e.SetConfig(defaultAPIEventConfig())
+				e.SetTriggeredDataCollectionRules(tt.rules)
+				err := p.Sample(context.Background(), e)
+				switch err {
+				case nil:
+					kept++
+					if !e.Config().IsActive || e.Config().SampleRate != tt.wantRate {
+						t.Errorf(`got config %+v, want active with sample rate %v`, e.Config(), tt.wantRate)
+					}
+				case events.DispatchStopRequest:
+					if e.Config().IsActive {
+						t.Error(`sampled out call is still active`)
+					}
+				default:
+					t.Fatalf(`unexpected error: %v`, err)
+				}
+			}
+			if kept != tt.wantKept {
+				t.Errorf(`kept %d calls, want %d`, kept, tt.wantKept)
+			}
+			if got := recorder.total(); got != 10-tt.wantKept {
+				t.Errorf(`got %d sampled out, want %d`, got, 10-tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestRoundTripper_SampledOut(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"hello": "world"}`))
+	}))
+	defer ts.Close()
+
+	recorder := &testSampleRecorder{}
+	dispatcher, reports := testReportRecorder()
+	dispatcher.AddProviders(TopicRequest, NewSamplingProvider(0, nil, recorder))
+	client := &http.Client{Transport: &RoundTripper{
+		Dispatcher: dispatcher,
+		Underlying: http.DefaultTransport,
+	}}
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf(`Get() error = %v`, err)
+	}
+	if _, ok := res.Body.(*BodyReadCloser); ok {
+		t.Error(`the body of a sampled out call is captured`)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if len(reports()) != 0 {
+		t.Errorf(`got %d reports for a sampled out call`, len(reports()))
+	}
+	if recorder.total() != 1 {
+		t.Errorf(`got %d sampled out calls, want 1`, recorder.total())
+	}
+}
@@ -2,6 +2,7 @@ package interception
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -25,6 +26,74 @@ var DefaultSensitiveData = regexp.MustCompile("(?i)[a-z0-9]{1}[a-z0-9.!#$%&’*+
 type SanitizationProvider struct {
 	SensitiveKeys    []*regexp.Regexp
 	SensitiveRegexps []*regexp.Regexp
+
+	// Detectors find sensitive data like the SensitiveRegexps, validating
+	// their matches.
+	Detectors []*Detector
+
+	// SensitivePaths select sensitive nodes in structured bodies, like
+	// SensitiveKeys but according to their position in the body.
+	SensitivePaths []*Selector
+
+	// Redactors are the redaction strategies of the sensitive keys, regexps,
+	// paths, and detectors, by expression or detector name. The values of
+	// sensitive keys and paths, and the matches of sensitive regexps and
+	// detectors, without a Redactor are replaced by Filtered.
+	Redactors map[string]Redactor
+}
+
+// redactor returns the Redactor of a sensitive key, regexp, path, or detector,
+// given by its expression or name, if any.
+func (p SanitizationProvider) redactor(expression string) (Redactor, bool) {
+	r, ok := p.Redactors[expression]
+	return r, ok && r != nil
+}
+
+// redactKey returns the redacted values of a sensitive key. Without a
+// Redactor, they are replaced by a single Filtered value.
+func (p SanitizationProvider) redactKey(key *regexp.Regexp, values []string) []string {
+	r, ok := p.redactor(key.String())
+	if !ok {
+		return []string{Filtered}
+	}
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = r.Redact(value)
+	}
+	return redacted
+}
+
+// redactMatches returns a string with the matches of a sensitive regexp
+// redacted.
+func (p SanitizationProvider) redactMatches(re *regexp.Regexp, s string) string {
+	r, ok := p.redactor(re.String())
+	if !ok {
+		return re.ReplaceAllLiteralString(s, Filtered)
+	}
+	return re.ReplaceAllStringFunc(s, r.Redact)
+}
+
+// redactDetected returns a string with the valid matches of a Detector
+// redacted.
+func (p SanitizationProvider) redactDetected(d *Detector, s string) string {
+	if r, ok := p.redactor(d.Name); ok {
+		return d.ReplaceAll(s, r.Redact)
+	}
+	return d.ReplaceAll(s, func(string) string { return Filtered })
+}
+
+// redactData returns a string with the sensitive data found by the sensitive
+// regexps and detectors redacted.
+func (p SanitizationProvider) redactData(s string) string {
+	for _, re := range p.SensitiveRegexps {
+		if re.MatchString(s) {
+			s = p.redactMatches(re, s)
+		}
+	}
+	for _, d := range p.Detectors {
+		s = p.redactDetected(d, s)
+	}
+	return s
 }
 
 // Listeners implements the events.ListenerProvider interface.
@@ -58,28 +127,19 @@ Name:
 		// Filter on keys, erasing all values.
 		for _, sk := range p.SensitiveKeys {
 			if sk.MatchString(name) {
-				out.Set(name, Filtered)
+				out[name] = p.redactKey(sk, values)
 				continue Name
 			}
 		}
 
 		// If the key didn't match replace the matching values.
 		for _, value := range values {
-			for _, sr := range p.SensitiveRegexps {
-				if sr.MatchString(value) {
-					value = sr.ReplaceAllLiteralString(value, Filtered)
-				}
-			}
-			out.Add(name, value)
+			out.Add(name, p.redactData(value))
 		}
 	}
 	sanU.RawQuery = out.Encode()
 
-	for _, r := range p.SensitiveRegexps {
-		if r.MatchString(sanU.Path) {
-			sanU.Path = r.ReplaceAllLiteralString(sanU.Path, Filtered)
-		}
-	}
+	sanU.Path = p.redactData(sanU.Path)
 	return sanU, nil
 }
 
@@ -94,19 +154,14 @@ Name:
 		// Filter on keys, erasing all values.
 		for _, sk := range p.SensitiveKeys {
 			if sk.MatchString(name) {
-				out.Set(name, Filtered)
+				out[name] = p.redactKey(sk, values)
 				continue Name
 			}
 		}
 
 		// If the key didn't match replace the matching values.
 		for _, value := range values {
-			for _, sr := range p.SensitiveRegexps {
-				if sr.MatchString(value) {
-					value = sr.ReplaceAllLiteralString(value, Filtered)
-				}
-			}
-			out.Add(name, value)
+			out.Add(name, p.redactData(value))
 		}
 	}
 
@@ -190,7 +245,7 @@ func (p SanitizationProvider) SanitizeRequestBody(_ context.Context, e events.Ev
 	if !ok {
 		return fmt.Errorf(`topic ReportEvent, got %T`, e)
 	}
-	w := NewWalker(re.RequestBody)
+	w := NewWalker(p.sanitizePaths(re.RequestBody))
 	var accu interface{}
 	err := w.Walk(&accu, p.BodySanitizer)
 	if err != nil {
@@ -206,7 +261,7 @@ func (p SanitizationProvider) SanitizeResponseBody(_ context.Context, e events.E
 	if !ok {
 		return fmt.Errorf(`topic ReportEvent, got %T`, e)
 	}
-	w := NewWalker(re.ResponseBody)
+	w := NewWalker(p.sanitizePaths(re.ResponseBody))
 	var accu interface{}
 	err := w.Walk(&accu, p.BodySanitizer)
 	if err != nil {
@@ -216,6 +271,17 @@ func (p SanitizationProvider) SanitizeResponseBody(_ context.Context, e events.E
 	return nil
 }
 
+// sanitizePaths redacts the nodes of a body selected by the sensitive paths,
+// before the sensitive keys and regexps apply to the rest of it.
+func (p SanitizationProvider) sanitizePaths(body interface{}) interface{} {
+	for _, s := range p.SensitivePaths {
+		body = s.Apply(body, func(v interface{}) interface{} {
+			return p.redactValue(s.String(), v)
+		})
+	}
+	return body
+}
+
 // BodySanitizer applies sanitization rules to data.
 func (p SanitizationProvider) BodySanitizer(k interface{}, v *interface{}, accu *interface{}) error {
 	if k == nil {
@@ -224,7 +290,7 @@ func (p SanitizationProvider) BodySanitizer(k interface{}, v *interface{}, accu
 	if sk, ok := k.(string); ok {
 		for _, re := range p.SensitiveKeys {
 			if re.MatchString(sk) {
-				*v = Filtered
+				*v = p.redactValue(re.String(), *v)
 				return nil
 			}
 		}
@@ -232,12 +298,23 @@ func (p SanitizationProvider) BodySanitizer(k interface{}, v *interface{}, accu
 
 	if reflect.ValueOf(*v).Kind() == reflect.String {
 		sv, _ := (*v).(string) // Cannot fail because of previous line.
-		for _, re := range p.SensitiveRegexps {
-			if re.MatchString(sv) {
-				sv = re.ReplaceAllLiteralString(sv, Filtered)
-			}
-		}
-		*v = sv
+		*v = p.redactData(sv)
 	}
 	return nil
 }
+
+// redactValue returns the redacted body value of a sensitive key or path. Only
+// scalar values are redacted with their Redactor: objects and arrays are
+// replaced by Filtered.
+func (p SanitizationProvider) redactValue(expression string, v interface{}) interface{} {
+	r, ok := p.redactor(expression)
+	if !ok {
+		return Filtered
+	}
+	switch v.(type) {
+	case string, float64, bool, json.Number:
+		return r.Redact(fmt.Sprint(v))
+	default:
+		return Filtered
+	}
+}
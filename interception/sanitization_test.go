@@ -21,7 +21,7 @@ const (
 func newSanitizationProvider() *interception.SanitizationProvider {
 	keysREs := []*regexp.Regexp{interception.DefaultSensitiveKeys}
 	valueREs := []*regexp.Regexp{interception.DefaultSensitiveData}
-	p := &interception.SanitizationProvider{keysREs, valueREs}
+	p := &interception.SanitizationProvider{SensitiveKeys: keysREs, SensitiveRegexps: valueREs}
 	return p
 }
 
@@ -238,6 +238,73 @@ func TestSanitizationProvider_sanitize(t *testing.T) {
 	}
 }
 
+func TestSanitizationProvider_Redactors(t *testing.T) {
+	p := newSanitizationProvider()
+	p.Redactors = map[string]interception.Redactor{
+		interception.DefaultSensitiveKeys.String(): interception.KeepLastRedactor{N: 2},
+		interception.DefaultSensitiveData.String(): interception.MaskRedactor{},
+	}
+	x := map[string]interface{}{
+		`password`: `hunter2`,
+		`secret`:   map[string]interface{}{`nested`: `value`},
+		`foo`:      `card ` + card[4:19],
+	}
+	expected := map[string]interface{}{
+		`password`: `*****r2`,
+		`secret`:   interception.Filtered,
+		`foo`:      `card ***************`,
+	}
+	w := interception.NewWalker(x)
+	var accu interface{}
+	if err := w.Walk(&accu, p.BodySanitizer); err != nil {
+		t.Fatalf("sanitize() error = %v", err)
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("sanitize got %v, wanted %v", x, expected)
+	}
+
+	res := &http.Response{Header: http.Header{`Authorization`: {`Bearer abc`, `Basic xyz`}}}
+	e := events.NewEvent(topic).SetResponse(res)
+	if err := p.SanitizeResponseHeaders(context.Background(), e); err != nil {
+		t.Fatalf("SanitizeResponseHeaders() error = %v", err)
+	}
+	if got, want := e.Response().Header[`Authorization`], []string{`********bc`, `*******yz`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sanitized header = %v, want %v", got, want)
+	}
+}
+
+func TestSanitizationProvider_SensitivePaths(t *testing.T) {
+	p := newSanitizationProvider()
+	for _, expression := range []string{`$.customer.address`, `$.items[*].card`} {
+		s, err := interception.ParseSelector(expression)
+		if err != nil {
+			t.Fatalf("ParseSelector() error = %v", err)
+		}
+		p.SensitivePaths = append(p.SensitivePaths, s)
+	}
+	p.Redactors = map[string]interception.Redactor{
+		`$.items[*].card`: interception.KeepLastRedactor{N: 4},
+	}
+	e := &interception.ReportEvent{
+		BodiesEvent: &interception.BodiesEvent{ResponseBody: map[string]interface{}{
+			`customer`: map[string]interface{}{`address`: map[string]interface{}{`city`: `Paris`}, `secret`: `s`},
+			`shipping`: map[string]interface{}{`address`: `2 Side St`},
+			`items`:    []interface{}{map[string]interface{}{`card`: `4111111111111111`}},
+		}},
+	}
+	expected := map[string]interface{}{
+		`customer`: map[string]interface{}{`address`: interception.Filtered, `secret`: interception.Filtered},
+		`shipping`: map[string]interface{}{`address`: `2 Side St`},
+		`items`:    []interface{}{map[string]interface{}{`card`: `************1111`}},
+	}
+	if err := p.SanitizeResponseBody(context.Background(), e); err != nil {
+		t.Fatalf("SanitizeResponseBody() error = %v", err)
+	}
+	if !reflect.DeepEqual(e.ResponseBody, expected) {
+		t.Errorf("SanitizeResponseBody got %v expected %v", e.ResponseBody, expected)
+	}
+}
+
 func TestSanitizationProvider_SanitizeRequestBody(t *testing.T) {
 	tests := []struct {
 		name     string
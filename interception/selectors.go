@@ -0,0 +1,177 @@
+package interception
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector addresses nodes in a structured body, like a JSON document or a
+// form, using a subset of the JSONPath syntax:
+//
+//	$                 the whole body
+//	.name, ['name']   the member of an object, or the field of a form
+//	[2]               the element of an array, starting at 0
+//	.*, [*]           any member or element
+//	..name, ..*       the matching members at any depth
+//
+// For instance, $.customer.address addresses the address of the customer but
+// not the one in $.shipping.address, and $.items[*].card the card of every
+// item.
+type Selector struct {
+	expression string
+	segments   []selectorSegment
+}
+
+// selectorSegment is one step of a Selector.
+type selectorSegment struct {
+	name       string
+	index      int
+	isIndex    bool
+	wildcard   bool
+	descendant bool
+}
+
+// ParseSelector parses a Selector expression.
+func ParseSelector(expression string) (*Selector, error) {
+	if !strings.HasPrefix(expression, `$`) {
+		return nil, fmt.Errorf("invalid selector %q: it must start with $", expression)
+	}
+	s := &Selector{expression: expression}
+	rest := expression[1:]
+	for rest != `` {
+		var seg selectorSegment
+		dotted := true
+		switch {
+		case strings.HasPrefix(rest, `..`):
+			seg.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, `.`):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, `[`):
+			dotted = false
+		default:
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q", expression, rest)
+		}
+
+		if !strings.HasPrefix(rest, `[`) {
+			end := strings.IndexAny(rest, `.[`)
+			if end < 0 {
+				end = len(rest)
+			}
+			seg.name, rest = rest[:end], rest[end:]
+			if seg.name == `` {
+				return nil, fmt.Errorf("invalid selector %q: empty member name", expression)
+			}
+			seg.wildcard = seg.name == `*`
+			s.segments = append(s.segments, seg)
+			continue
+		}
+		if dotted && !seg.descendant {
+			return nil, fmt.Errorf("invalid selector %q: unexpected bracket after dot", expression)
+		}
+
+		// Bracket notation.
+		end := strings.Index(rest, `]`)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid selector %q: unclosed bracket", expression)
+		}
+		inner := rest[1:end]
+		rest = rest[end+1:]
+		switch {
+		case inner == `*`:
+			seg.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			seg.name = inner[1 : len(inner)-1]
+		default:
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid selector %q: invalid index %q", expression, inner)
+			}
+			seg.index, seg.isIndex = index, true
+		}
+		s.segments = append(s.segments, seg)
+	}
+	return s, nil
+}
+
+// String implements fmt.Stringer, returning the Selector expression.
+func (s *Selector) String() string {
+	return s.expression
+}
+
+// Apply replaces the nodes of a body addressed by the Selector with the result
+// of fn applied to them, and returns the updated body. Maps and slices are
+// updated in place.
+//
+// It supports the values unmarshalled from JSON, and forms as
+// map[string][]string, in which fields are arrays of strings: fn is applied
+// to each of their values when a field is selected as a whole.
+func (s *Selector) Apply(body interface{}, fn func(interface{}) interface{}) interface{} {
+	return applySegments(body, s.segments, fn)
+}
+
+func applySegments(v interface{}, segments []selectorSegment, fn func(interface{}) interface{}) interface{} {
+	if len(segments) == 0 {
+		return fn(v)
+	}
+	seg, rest := segments[0], segments[1:]
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if seg.matchesKey(k) {
+				child = applySegments(child, rest, fn)
+				node[k] = child
+			}
+			if seg.descendant {
+				node[k] = applySegments(child, segments, fn)
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if seg.matchesIndex(i) {
+				child = applySegments(child, rest, fn)
+				node[i] = child
+			}
+			if seg.descendant {
+				node[i] = applySegments(child, segments, fn)
+			}
+		}
+	case map[string][]string:
+		for k, values := range node {
+			if seg.matchesKey(k) {
+				node[k] = applyFormValues(values, rest, fn)
+			}
+		}
+	}
+	return v
+}
+
+// applyFormValues applies segments to the values of a form field, handling
+// them as an array of strings.
+func applyFormValues(values []string, segments []selectorSegment, fn func(interface{}) interface{}) []string {
+	if len(segments) == 0 {
+		segments = []selectorSegment{{wildcard: true}}
+	}
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	result := applySegments(list, segments, fn)
+	if list, ok := result.([]interface{}); ok {
+		values = make([]string, len(list))
+		for i, value := range list {
+			values[i] = fmt.Sprint(value)
+		}
+		return values
+	}
+	return []string{fmt.Sprint(result)}
+}
+
+func (seg selectorSegment) matchesKey(k string) bool {
+	return seg.wildcard || (!seg.isIndex && seg.name == k)
+}
+
+func (seg selectorSegment) matchesIndex(i int) bool {
+	return seg.wildcard || (seg.isIndex && seg.index == i)
+}
@@ -0,0 +1,115 @@
+package interception_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bearer/go-agent/interception"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    bool
+	}{
+		{`$`, false},
+		{`$.customer.address`, false},
+		{`$.items[*].card`, false},
+		{`$.items[2]`, false},
+		{`$['first name']`, false},
+		{`$["first name"].*`, false},
+		{`$..password`, false},
+		{`$..[0]`, false},
+		{`customer`, true},
+		{`$.`, true},
+		{`$.items[`, true},
+		{`$.items[-1]`, true},
+		{`$.items[x]`, true},
+		{`$.[0]`, true},
+		{`$customer`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			s, err := interception.ParseSelector(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(`ParseSelector() error = %v, wantErr %v`, err, tt.wantErr)
+			}
+			if err == nil && s.String() != tt.expression {
+				t.Errorf(`String() = %s, want %s`, s, tt.expression)
+			}
+		})
+	}
+}
+
+func TestSelector_Apply(t *testing.T) {
+	const x = `X`
+	body := func() map[string]interface{} {
+		return map[string]interface{}{
+			`customer`: map[string]interface{}{`name`: `Jane`, `address`: `1 Main St`},
+			`shipping`: map[string]interface{}{`address`: `2 Side St`},
+			`items`: []interface{}{
+				map[string]interface{}{`sku`: `a`, `card`: `4111`},
+				map[string]interface{}{`sku`: `b`, `card`: `5500`},
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		expression string
+		body       interface{}
+		want       interface{}
+	}{
+		{`member`, `$.customer.address`, body(), map[string]interface{}{
+			`customer`: map[string]interface{}{`name`: `Jane`, `address`: x},
+			`shipping`: map[string]interface{}{`address`: `2 Side St`},
+			`items`: []interface{}{
+				map[string]interface{}{`sku`: `a`, `card`: `4111`},
+				map[string]interface{}{`sku`: `b`, `card`: `5500`},
+			},
+		}},
+		{`wildcard index`, `$.items[*].card`, body(), map[string]interface{}{
+			`customer`: map[string]interface{}{`name`: `Jane`, `address`: `1 Main St`},
+			`shipping`: map[string]interface{}{`address`: `2 Side St`},
+			`items`: []interface{}{
+				map[string]interface{}{`sku`: `a`, `card`: x},
+				map[string]interface{}{`sku`: `b`, `card`: x},
+			},
+		}},
+		{`index`, `$.items[1]`, body(), map[string]interface{}{
+			`customer`: map[string]interface{}{`name`: `Jane`, `address`: `1 Main St`},
+			`shipping`: map[string]interface{}{`address`: `2 Side St`},
+			`items`: []interface{}{
+				map[string]interface{}{`sku`: `a`, `card`: `4111`},
+				x,
+			},
+		}},
+		{`descendant`, `$..address`, body(), map[string]interface{}{
+			`customer`: map[string]interface{}{`name`: `Jane`, `address`: x},
+			`shipping`: map[string]interface{}{`address`: x},
+			`items`: []interface{}{
+				map[string]interface{}{`sku`: `a`, `card`: `4111`},
+				map[string]interface{}{`sku`: `b`, `card`: `5500`},
+			},
+		}},
+		{`no match`, `$.customer.address.street`, body(), body()},
+		{`root`, `$`, body(), x},
+		{`form field`, `$.card`,
+			map[string][]string{`card`: {`4111`, `5500`}, `name`: {`Jane`}},
+			map[string][]string{`card`: {x, x}, `name`: {`Jane`}}},
+		{`form value`, `$['card'][1]`,
+			map[string][]string{`card`: {`4111`, `5500`}},
+			map[string][]string{`card`: {`4111`, x}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := interception.ParseSelector(tt.expression)
+			if err != nil {
+				t.Fatalf(`ParseSelector() error = %v`, err)
+			}
+			got := s.Apply(tt.body, func(interface{}) interface{} { return x })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf(`Apply() = %v, want %v`, got, tt.want)
+			}
+		})
+	}
+}
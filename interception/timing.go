@@ -0,0 +1,83 @@
+package interception
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+// Timing records the phases of an outbound API call, from the hooks of a
+// httptrace.ClientTrace.
+type Timing struct {
+	m sync.Mutex
+
+	DNSStart, DNSDone         time.Time
+	ConnectStart, ConnectDone time.Time
+	TLSStart, TLSDone         time.Time
+	FirstByte                 time.Time
+	BodyDone                  time.Time
+
+	// Reused is true if the call was made on a previously used connection.
+	Reused bool
+}
+
+// ClientTrace returns a httptrace.ClientTrace recording the phases of an API
+// call in the Timing.
+func (t *Timing) ClientTrace() *httptrace.ClientTrace {
+	// set records the first occurrence of a phase: with multiple IP addresses,
+	// a connection may be attempted several times.
+	set := func(field *time.Time) {
+		t.m.Lock()
+		defer t.m.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&t.DNSStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(&t.DNSDone) },
+		ConnectStart: func(string, string) {
+			set(&t.ConnectStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				set(&t.ConnectDone)
+			}
+		},
+		TLSHandshakeStart: func() { set(&t.TLSStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				set(&t.TLSDone)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.m.Lock()
+			defer t.m.Unlock()
+			t.Reused = info.Reused
+		},
+		GotFirstResponseByte: func() { set(&t.FirstByte) },
+	}
+}
+
+// report builds the proxy.ReportTimings of an API call started at t0.
+func (t *Timing) report(t0 time.Time) *proxy.ReportTimings {
+	t.m.Lock()
+	defer t.m.Unlock()
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return float64(to.Sub(from)) / float64(time.Millisecond)
+	}
+	return &proxy.ReportTimings{
+		DNSLookup:        ms(t.DNSStart, t.DNSDone),
+		TCPConnect:       ms(t.ConnectStart, t.ConnectDone),
+		TLSHandshake:     ms(t.TLSStart, t.TLSDone),
+		FirstByte:        ms(t0, t.FirstByte),
+		BodyDone:         ms(t0, t.BodyDone),
+		ConnectionReused: t.Reused,
+	}
+}
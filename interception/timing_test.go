@@ -0,0 +1,82 @@
+package interception
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sort"
+	"testing"
+)
+
+func TestRoundTripper_Timing(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`hello`))
+	}))
+	defer ts.Close()
+
+	dispatcher, reports := testReportRecorder()
+	client := &http.Client{Transport: &RoundTripper{
+		Dispatcher: dispatcher,
+		Underlying: ts.Client().Transport,
+	}}
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf(`Get() error = %v`, err)
+		}
+		_, _ = ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+	got := waitReports(reports, 2)
+	if len(got) != 2 {
+		t.Fatalf(`got %d reports, want 2`, len(got))
+	}
+	// The reports are dispatched asynchronously, in any order.
+	sort.Slice(got, func(i, j int) bool { return got[i].T0.Before(got[j].T0) })
+
+	first := got[0].Timing.report(got[0].T0)
+	if first.ConnectionReused || first.TCPConnect <= 0 || first.TLSHandshake <= 0 {
+		t.Errorf(`first call timings %+v, want a new TLS connection`, first)
+	}
+	if first.FirstByte <= 0 || first.BodyDone < first.FirstByte {
+		t.Errorf(`first call timings %+v, want the body done after the first byte`, first)
+	}
+	second := got[1].Timing.report(got[1].T0)
+	if !second.ConnectionReused || second.TCPConnect != 0 || second.TLSHandshake != 0 {
+		t.Errorf(`second call timings %+v, want a reused connection`, second)
+	}
+}
+
+func TestRoundTripper_TimingInactive(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		wantTrace bool
+	}{
+		{`reported`, 1, true},
+		{`sampled out`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher, _ := testReportRecorder()
+			dispatcher.AddProviders(TopicRequest, NewSamplingProvider(tt.rate, nil, nil))
+			original, _ := http.NewRequest(http.MethodGet, `http://example.com/`, nil)
+			rt := &RoundTripper{
+				Dispatcher: dispatcher,
+				Underlying: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+					traced := httptrace.ContextClientTrace(request.Context()) != nil
+					if traced != tt.wantTrace || (!tt.wantTrace && request != original) {
+						t.Errorf(`got traced %t, copied %t, want traced %t`, traced, request != original, tt.wantTrace)
+					}
+					return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody, Request: request}, nil
+				}),
+			}
+			res, err := rt.RoundTrip(original)
+			if err != nil {
+				t.Fatalf(`RoundTrip() error = %v`, err)
+			}
+			_ = res.Body.Close()
+		})
+	}
+}
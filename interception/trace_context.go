@@ -0,0 +1,171 @@
+package interception
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the canonical W3C Trace Context traceparent header name.
+	TraceParentHeader = `Traceparent`
+
+	// TraceStateHeader is the canonical W3C Trace Context tracestate header name.
+	TraceStateHeader = `Tracestate`
+
+	// traceFlagSampled is the W3C Trace Context flag for sampled traces.
+	traceFlagSampled = 0x01
+
+	// traceContextKey is the context key of the TraceContext of the current span.
+	traceContextKey ContextKey = `traceContext`
+)
+
+// TraceContext identifies a span in a distributed trace, as per the W3C Trace
+// Context recommendation.
+type TraceContext struct {
+	// TraceID is the trace ID, as 32 lowercase hexadecimal digits.
+	TraceID string
+
+	// SpanID is the span ID, as 16 lowercase hexadecimal digits.
+	SpanID string
+
+	// ParentSpanID is the ID of the parent span, or empty if it is unknown or
+	// if the span is the trace root.
+	ParentSpanID string
+
+	// Flags are the trace flags, like the sampled flag.
+	Flags byte
+
+	// State is the tracestate value, propagated unchanged.
+	State string
+}
+
+// IsValid checks whether the TraceContext identifies a span.
+func (tc TraceContext) IsValid() bool {
+	return isTraceID(tc.TraceID, 32) && isTraceID(tc.SpanID, 16)
+}
+
+// TraceParent returns the traceparent header value for the TraceContext.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf(`00-%s-%s-%02x`, tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// child returns a TraceContext for a new span, child of tc in the same trace.
+func (tc TraceContext) child() TraceContext {
+	return TraceContext{
+		TraceID:      tc.TraceID,
+		SpanID:       randomTraceID(8),
+		ParentSpanID: tc.SpanID,
+		Flags:        tc.Flags,
+		State:        tc.State,
+	}
+}
+
+// newTraceContext returns a TraceContext for the root span of a new trace.
+func newTraceContext() TraceContext {
+	return TraceContext{
+		TraceID: randomTraceID(16),
+		SpanID:  randomTraceID(8),
+		Flags:   traceFlagSampled,
+	}
+}
+
+// randomTraceID returns a random hexadecimal ID of n bytes.
+func randomTraceID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isTraceID checks whether s is a valid trace or span ID of n lowercase
+// hexadecimal digits, which may not all be zeros.
+func isTraceID(s string, n int) bool {
+	if len(s) != n || s == strings.Repeat(`0`, n) {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseTraceParent parses a traceparent header value. Values of unknown future
+// versions are parsed as version 00, ignoring any additional fields.
+func ParseTraceParent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), `-`)
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return TraceContext{}, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return TraceContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return TraceContext{}, false
+	}
+	tc := TraceContext{TraceID: parts[1], SpanID: parts[2], Flags: flags[0]}
+	if !tc.IsValid() {
+		return TraceContext{}, false
+	}
+	return tc, true
+}
+
+// ContextWithTraceContext returns a copy of ctx carrying tc as the current span.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, tc)
+}
+
+// TraceContextFromContext returns the TraceContext of the current span in ctx,
+// if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// outboundTraceContext returns the TraceContext of an outbound request, and
+// the request to send.
+//
+// If the request already carries a traceparent header, as set by another
+// tracer, it is used unchanged. Otherwise, if propagate is true, a clone of the
+// request carrying the TraceContext of a new span is returned, continuing the
+// trace of the current span in the request context, if any.
+func outboundTraceContext(request *http.Request, propagate bool) (*http.Request, TraceContext) {
+	if tc, ok := ParseTraceParent(request.Header.Get(TraceParentHeader)); ok {
+		tc.State = request.Header.Get(TraceStateHeader)
+		return request, tc
+	}
+	if !propagate {
+		return request, TraceContext{}
+	}
+
+	tc := newTraceContext()
+	if parent, ok := TraceContextFromContext(request.Context()); ok {
+		tc = parent.child()
+	}
+	request = request.Clone(request.Context())
+	if request.Header == nil {
+		request.Header = make(http.Header)
+	}
+	request.Header.Set(TraceParentHeader, tc.TraceParent())
+	if tc.State != `` {
+		request.Header.Set(TraceStateHeader, tc.State)
+	}
+	return request, tc
+}
+
+// inboundTraceContext returns the TraceContext of the span serving an inbound
+// request, continuing the trace of the caller, if any.
+func inboundTraceContext(request *http.Request) TraceContext {
+	parent, ok := ParseTraceParent(request.Header.Get(TraceParentHeader))
+	if !ok {
+		return newTraceContext()
+	}
+	parent.State = request.Header.Get(TraceStateHeader)
+	return parent.child()
+}
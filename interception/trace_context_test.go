@@ -0,0 +1,144 @@
+package interception
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bearer/go-agent/events"
+)
+
+const (
+	testTraceID     = `4bf92f3577b34da6a3ce929d0e0e4736`
+	testSpanID      = `00f067aa0ba902b7`
+	testTraceParent = `00-` + testTraceID + `-` + testSpanID + `-01`
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		wantOK bool
+	}{
+		{`happy`, testTraceParent, true},
+		{`happy future version`, `cc-` + testTraceID + `-` + testSpanID + `-01-extra`, true},
+		{`sad version 00 extra`, testTraceParent + `-extra`, false},
+		{`sad version ff`, `ff-` + testTraceID + `-` + testSpanID + `-01`, false},
+		{`sad zero trace ID`, `00-00000000000000000000000000000000-` + testSpanID + `-01`, false},
+		{`sad zero span ID`, `00-` + testTraceID + `-0000000000000000-01`, false},
+		{`sad uppercase`, `00-4BF92F3577B34DA6A3CE929D0E0E4736-` + testSpanID + `-01`, false},
+		{`sad short`, `00-` + testTraceID + `-01`, false},
+		{`sad empty`, ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, ok := ParseTraceParent(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf(`ParseTraceParent() ok = %t, want %t`, ok, tt.wantOK)
+			}
+			if ok && (tc.TraceID != testTraceID || tc.SpanID != testSpanID || tc.Flags != 1) {
+				t.Errorf(`ParseTraceParent() = %+v`, tc)
+			}
+		})
+	}
+}
+
+func TestOutboundTraceContext(t *testing.T) {
+	parent := TraceContext{TraceID: testTraceID, SpanID: testSpanID, Flags: 1, State: `vendor=value`}
+	tests := []struct {
+		name        string
+		header      string
+		ctx         context.Context
+		propagate   bool
+		wantInject  bool
+		wantTraceID string
+		wantParent  string
+	}{
+		{`disabled`, ``, context.Background(), false, false, ``, ``},
+		{`existing header`, testTraceParent, context.Background(), false, false, testTraceID, ``},
+		{`new trace`, ``, context.Background(), true, true, ``, ``},
+		{`continued trace`, ``, ContextWithTraceContext(context.Background(), parent), true, true, testTraceID, testSpanID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, defaultTestURL, nil)
+			if tt.header != `` {
+				req.Header.Set(TraceParentHeader, tt.header)
+			}
+			got, tc := outboundTraceContext(req, tt.propagate)
+			if (got != req) != tt.wantInject {
+				t.Fatalf(`outboundTraceContext() cloned the request: %t, want %t`, got != req, tt.wantInject)
+			}
+			if tt.wantInject {
+				if req.Header.Get(TraceParentHeader) != `` {
+					t.Error(`outboundTraceContext() modified the original request`)
+				}
+				if h := got.Header.Get(TraceParentHeader); h != tc.TraceParent() {
+					t.Errorf(`injected traceparent = %s, want %s`, h, tc.TraceParent())
+				}
+			}
+			if tt.propagate && !tc.IsValid() {
+				t.Errorf(`outboundTraceContext() = invalid %+v`, tc)
+			}
+			if tt.wantTraceID != `` && tc.TraceID != tt.wantTraceID {
+				t.Errorf(`trace ID = %s, want %s`, tc.TraceID, tt.wantTraceID)
+			}
+			if tc.ParentSpanID != tt.wantParent {
+				t.Errorf(`parent span ID = %s, want %s`, tc.ParentSpanID, tt.wantParent)
+			}
+			if tt.wantParent != `` && got.Header.Get(TraceStateHeader) != parent.State {
+				t.Errorf(`tracestate = %s, want %s`, got.Header.Get(TraceStateHeader), parent.State)
+			}
+		})
+	}
+}
+
+// roundTripperFunc is a http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestHandler_TraceContext(t *testing.T) {
+	var sent *http.Request
+	dispatcher, reports := testReportRecorder()
+	rt := &RoundTripper{
+		Dispatcher: dispatcher,
+		Underlying: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			sent = request
+			return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: request}, nil
+		}),
+		PropagateTraceContext: true,
+	}
+	var server TraceContext
+	h := &Handler{
+		Dispatcher:            events.NewDispatcher(),
+		PropagateTraceContext: true,
+		Underlying: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			server, _ = TraceContextFromContext(r.Context())
+			req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, defaultTestURL, nil)
+			if _, err := rt.RoundTrip(req); err != nil {
+				t.Errorf(`RoundTrip() error = %v`, err)
+			}
+		}),
+	}
+	req := httptest.NewRequest(http.MethodGet, `/`, nil)
+	req.Header.Set(TraceParentHeader, testTraceParent)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if server.TraceID != testTraceID || server.ParentSpanID != testSpanID {
+		t.Fatalf(`server span = %+v, want a child of %s`, server, testTraceParent)
+	}
+	client, ok := ParseTraceParent(sent.Header.Get(TraceParentHeader))
+	if !ok || client.TraceID != testTraceID || client.SpanID == server.SpanID {
+		t.Errorf(`client span = %+v, want a new span in trace %s`, client, testTraceID)
+	}
+	if len(reports()) != 1 {
+		t.Fatalf(`got %d reports, want 1`, len(reports()))
+	}
+	if tc := reports()[0].TraceContext; tc.SpanID != client.SpanID || tc.ParentSpanID != server.SpanID {
+		t.Errorf(`reported trace context = %+v, want span %s child of %s`, tc, client.SpanID, server.SpanID)
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ContentEncodingHeader is the canonical Content-Encoding header name.
+	ContentEncodingHeader = `Content-Encoding`
+
+	// CompressionNone disables payload compression.
+	CompressionNone = ``
+
+	// CompressionGzip is the Content-Encoding for gzip compressed payloads.
+	CompressionGzip = `gzip`
+
+	// CompressionZstd is the Content-Encoding for Zstandard compressed payloads.
+	CompressionZstd = `zstd`
+)
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+	zstdEncoderOnce sync.Once
+)
+
+// IsValidCompression checks whether an encoding is supported by Compress.
+func IsValidCompression(encoding string) bool {
+	switch encoding {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compress compresses a payload for the given Content-Encoding. With
+// CompressionNone, the payload is returned unchanged.
+func Compress(encoding string, payload []byte) ([]byte, error) {
+	switch encoding {
+	case CompressionNone:
+		return payload, nil
+
+	case CompressionGzip:
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case CompressionZstd:
+		// The encoder is safe for concurrent use through EncodeAll, and
+		// expensive to build, so it is shared.
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+		})
+		if zstdEncoderErr != nil {
+			return nil, zstdEncoderErr
+		}
+		return zstdEncoder.EncodeAll(payload, nil), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", encoding)
+	}
+}
@@ -0,0 +1,101 @@
+package proxy_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/bearer/go-agent"
+	"github.com/bearer/go-agent/proxy"
+)
+
+func decompress(t *testing.T, encoding string, payload []byte) []byte {
+	switch encoding {
+	case proxy.CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf(`invalid gzip payload: %v`, err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf(`invalid gzip payload: %v`, err)
+		}
+		return data
+	case proxy.CompressionZstd:
+		r, _ := zstd.NewReader(nil)
+		data, err := r.DecodeAll(payload, nil)
+		if err != nil {
+			t.Fatalf(`invalid zstd payload: %v`, err)
+		}
+		return data
+	default:
+		return payload
+	}
+}
+
+func TestCompress(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"compressible":true}`), 100)
+	tests := []struct {
+		name     string
+		encoding string
+		wantErr  bool
+	}{
+		{`none`, proxy.CompressionNone, false},
+		{`gzip`, proxy.CompressionGzip, false},
+		{`zstd`, proxy.CompressionZstd, false},
+		{`sad unsupported`, `lzma`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if proxy.IsValidCompression(tt.encoding) == tt.wantErr {
+				t.Errorf(`IsValidCompression(%s) = %t`, tt.encoding, !tt.wantErr)
+			}
+			got, err := proxy.Compress(tt.encoding, payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(`Compress() error = %v, wantErr %t`, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.encoding != proxy.CompressionNone && len(got) >= len(payload) {
+				t.Errorf(`Compress() did not reduce size: %d >= %d`, len(got), len(payload))
+			}
+			if !bytes.Equal(decompress(t, tt.encoding, got), payload) {
+				t.Errorf(`Compress() did not round-trip`)
+			}
+		})
+	}
+}
+
+func TestHTTPExporter_ExportCompressed(t *testing.T) {
+	for _, encoding := range []string{proxy.CompressionNone, proxy.CompressionGzip, proxy.CompressionZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			var got proxy.LogReport
+			var gotEncoding string
+			ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				gotEncoding = request.Header.Get(proxy.ContentEncodingHeader)
+				body, _ := ioutil.ReadAll(request.Body)
+				_ = json.Unmarshal(decompress(t, gotEncoding, body), &got)
+			}))
+			defer ts.Close()
+
+			e := proxy.NewHTTPExporter(ts.URL, agent.ExampleWellFormedInvalidKey, ts.Client().Transport)
+			e.Compression = encoding
+			if _, err := e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{Method: http.MethodGet}}}); err != nil {
+				t.Fatalf(`Export() error: %v`, err)
+			}
+			if gotEncoding != encoding {
+				t.Errorf(`got Content-Encoding %s, want %s`, gotEncoding, encoding)
+			}
+			if len(got.Logs) != 1 || got.Logs[0].Method != http.MethodGet {
+				t.Errorf(`got unexpected report %v`, got)
+			}
+		})
+	}
+}
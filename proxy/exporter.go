@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxErrorBodyLength is the maximum length of the response body included in
+// the HTTPExporter errors.
+const maxErrorBodyLength = 256
+
+// maxDrainedBodyLength is the maximum length of the response bodies read to
+// their end so that their connection is reused.
+const maxDrainedBodyLength = 64 << 10
+
+// Exporter is the interface for the destinations of LogReport values built by
+// the Sender. Export returns the size of the exported payload, which may be 0
+// if the Exporter does not serialize LogReport values.
+//
+// Exporters may be called concurrently. Errors implementing the Retryable
+// interface with a true value are retried by the Sender, and spooled if they
+// still fail, while other errors cause the report to be lost.
+type Exporter interface {
+	Export(report LogReport) (int, error)
+}
+
+// Retryable is the interface implemented by Exporter errors which may not
+// happen again on a later attempt.
+type Retryable interface {
+	Retryable() bool
+}
+
+// HTTPExporter is the default Exporter, transmitting LogReport values as JSON
+// to the Bearer platform.
+type HTTPExporter struct {
+	// Endpoint is the URL of the Bearer host receiving the logs.
+	Endpoint string
+
+	// SecretKey is the account secret key.
+	SecretKey string
+
+	// Client is the HTTP client used for transmission. If nil, the
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Compression is the Content-Encoding applied to the transmitted payloads,
+	// one of CompressionNone, CompressionGzip, or CompressionZstd.
+	Compression string
+}
+
+// NewHTTPExporter builds an HTTPExporter using the passed transport.
+func NewHTTPExporter(endPoint string, secretKey string, transport http.RoundTripper) *HTTPExporter {
+	return &HTTPExporter{
+		Endpoint:  MustParseURL(endPoint).String(),
+		SecretKey: secretKey,
+		Client:    &http.Client{Transport: transport},
+	}
+}
+
+// Export implements the Exporter interface. On failure, the returned error
+// implements Retryable.
+func (e *HTTPExporter) Export(report LogReport) (int, error) {
+	// Cannot fail: the LogReport is made of basic JSON types.
+	body, _ := json.Marshal(report)
+	payload, err := Compress(e.Compression, body)
+	if err != nil {
+		return 0, &transmissionError{err: fmt.Errorf("compressing the log request: %w", err)}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return 0, &transmissionError{err: fmt.Errorf("building the log request: %w", err)}
+	}
+	req.Header.Add(AuthorizationHeader, e.SecretKey)
+	req.Header.Add(AcceptHeader, ContentTypeJSON)
+	req.Header.Set(ContentTypeHeader, FullContentTypeJSON)
+	if e.Compression != CompressionNone {
+		req.Header.Set(ContentEncodingHeader, e.Compression)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, &transmissionError{err: err, retryable: true}
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode < http.StatusContinue || res.StatusCode >= http.StatusBadRequest {
+		message := responseErrorMessage("got response "+res.Status, resBody, err)
+		if len(resBody) == 0 {
+			resBody = []byte(`[]`)
+		}
+		return 0, &transmissionError{
+			err:          errors.New(message),
+			retryable:    isRetryableStatus(res.StatusCode),
+			retryAfter:   parseRetryAfter(res.Header.Get(RetryAfterHeader), time.Now()),
+			statusCode:   res.StatusCode,
+			report:       body,
+			responseBody: resBody,
+		}
+	}
+	return len(payload), nil
+}
+
+// responseErrorMessage builds the message of the errors caused by unexpected
+// responses, from a description of the response, and its body or the error
+// reading it. The body is cut after maxErrorBodyLength bytes.
+func responseErrorMessage(response string, body []byte, err error) string {
+	if err != nil {
+		return fmt.Sprintf("%s: reading body: %v", response, err)
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return response
+	}
+	if len(trimmed) > maxErrorBodyLength {
+		trimmed = append(trimmed[:maxErrorBodyLength:maxErrorBodyLength], "..."...)
+	}
+	return fmt.Sprintf("%s: %s", response, trimmed)
+}
+
+// WriterExporter is an Exporter writing LogReport values as JSON lines to an
+// io.Writer, like a file or os.Stdout.
+type WriterExporter struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+// NewWriterExporter builds a WriterExporter writing to w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// Export implements the Exporter interface.
+func (e *WriterExporter) Export(report LogReport) (int, error) {
+	// Cannot fail: the LogReport is made of basic JSON types.
+	line, _ := json.Marshal(report)
+	line = append(line, '\n')
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.w.Write(line)
+}
+
+// MemoryExporter is an Exporter keeping LogReport values in memory, for
+// development and testing purposes.
+type MemoryExporter struct {
+	m       sync.Mutex
+	reports []LogReport
+}
+
+// NewMemoryExporter builds an empty MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// Export implements the Exporter interface. As it does not serialize the
+// LogReport, it always returns a 0 size.
+func (e *MemoryExporter) Export(report LogReport) (int, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.reports = append(e.reports, report)
+	return 0, nil
+}
+
+// Reports returns a copy of the LogReport values exported so far.
+func (e *MemoryExporter) Reports() []LogReport {
+	e.m.Lock()
+	defer e.m.Unlock()
+	reports := make([]LogReport, len(e.reports))
+	copy(reports, e.reports)
+	return reports
+}
+
+// Logs returns the ReportLog elements in all the LogReport values exported so far.
+func (e *MemoryExporter) Logs() []ReportLog {
+	e.m.Lock()
+	defer e.m.Unlock()
+	var logs []ReportLog
+	for _, report := range e.reports {
+		logs = append(logs, report.Logs...)
+	}
+	return logs
+}
+
+// Reset forgets the LogReport values exported so far.
+func (e *MemoryExporter) Reset() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.reports = nil
+}
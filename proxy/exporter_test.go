@@ -0,0 +1,117 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bearer/go-agent"
+	"github.com/bearer/go-agent/proxy"
+)
+
+func TestHTTPExporter_Export(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantErr       bool
+		wantRetryable bool
+		wantMessage   string
+	}{
+		{`happy`, http.StatusOK, ``, false, false, ``},
+		{`sad rejected`, http.StatusUnauthorized, `invalid key`, true, false, `got response 401 Unauthorized: invalid key`},
+		{`sad unavailable`, http.StatusServiceUnavailable, ``, true, true, `got response 503 Service Unavailable`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auth string
+			ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				auth = request.Header.Get(proxy.AuthorizationHeader)
+				writer.WriteHeader(tt.status)
+				_, _ = writer.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			e := proxy.NewHTTPExporter(ts.URL, agent.ExampleWellFormedInvalidKey, ts.Client().Transport)
+			size, err := e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{}}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(`Export() error = %v, wantErr %t`, err, tt.wantErr)
+			}
+			if (size > 0) == tt.wantErr {
+				t.Errorf(`Export() size = %d, wantErr %t`, size, tt.wantErr)
+			}
+			if auth != agent.ExampleWellFormedInvalidKey {
+				t.Errorf(`Export() sent authorization %s`, auth)
+			}
+			if err == nil {
+				return
+			}
+			var r proxy.Retryable
+			if !errors.As(err, &r) || r.Retryable() != tt.wantRetryable {
+				t.Errorf(`Export() error retryable: want %t`, tt.wantRetryable)
+			}
+			if !strings.HasSuffix(err.Error(), tt.wantMessage) {
+				t.Errorf(`Export() error = %v, want it to end with %s`, err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestWriterExporter_Export(t *testing.T) {
+	buf := &bytes.Buffer{}
+	e := proxy.NewWriterExporter(buf)
+	for i := 0; i < 2; i++ {
+		size, err := e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{StatusCode: i}}})
+		if err != nil {
+			t.Fatalf(`Export() error: %v`, err)
+		}
+		if size == 0 {
+			t.Errorf(`Export() size = 0`)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf(`got %d lines, want 2`, len(lines))
+	}
+	for i, line := range lines {
+		lr := proxy.LogReport{}
+		if err := json.Unmarshal([]byte(line), &lr); err != nil || lr.Logs[0].StatusCode != i {
+			t.Errorf(`line %d is not the expected LogReport: %s`, i, line)
+		}
+	}
+}
+
+func TestMemoryExporter(t *testing.T) {
+	e := proxy.NewMemoryExporter()
+	_, _ = e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{}, {}}})
+	_, _ = e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{}}})
+	if n := len(e.Reports()); n != 2 {
+		t.Errorf(`Reports() len = %d, want 2`, n)
+	}
+	if n := len(e.Logs()); n != 3 {
+		t.Errorf(`Logs() len = %d, want 3`, n)
+	}
+	e.Reset()
+	if n := len(e.Reports()); n != 0 {
+		t.Errorf(`Reports() len after Reset = %d, want 0`, n)
+	}
+}
+
+func TestSender_Exporter(t *testing.T) {
+	e := proxy.NewMemoryExporter()
+	s, _ := makeTestSender()
+	s.Exporter = e
+	s.BatchSize = 10
+	go s.Start()
+	for i := 0; i < 3; i++ {
+		s.Send(proxy.ReportLog{})
+	}
+	s.Stop()
+	if n := len(e.Logs()); n != 3 {
+		t.Errorf(`exported %d logs, want 3`, n)
+	}
+}
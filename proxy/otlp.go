@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultOTLPServiceName is the OpenTelemetry service name used by the
+	// OTLPExporter if none is configured, per the resource semantic conventions.
+	DefaultOTLPServiceName = `unknown_service:go`
+
+	// OTLPTracesPath is the default path of the OTLP/HTTP traces endpoint.
+	OTLPTracesPath = `/v1/traces`
+
+	// OTLPScopeName is the instrumentation scope name of the spans built by the
+	// OTLPExporter.
+	OTLPScopeName = `github.com/bearer/go-agent`
+
+	// otlpSpanKindClient is the OTLP SpanKind for outbound calls.
+	otlpSpanKindClient = 3
+	// otlpSpanKindServer is the OTLP SpanKind for inbound calls.
+	otlpSpanKindServer = 2
+	// otlpStatusError is the OTLP StatusCode for failed calls.
+	otlpStatusError = 2
+)
+
+// OTLPExporter is an Exporter transmitting the ReportLog elements of API calls
+// as spans to an OpenTelemetry collector, using OTLP/HTTP with JSON encoding.
+//
+// Span attributes follow the OpenTelemetry HTTP client semantic conventions.
+// Synthetic ReportLog elements, like loss and sampling reports, are not
+// exported.
+type OTLPExporter struct {
+	// Endpoint is the URL of the collector traces endpoint, usually ending with
+	// OTLPTracesPath.
+	Endpoint string
+
+	// Headers are added to the export requests, e.g. for authentication.
+	Headers http.Header
+
+	// ServiceName is the service.name resource attribute of the spans.
+	ServiceName string
+
+	// Client is the HTTP client used for transmission. If nil, the
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewOTLPExporter builds an OTLPExporter to a collector traces endpoint, using
+// the passed transport.
+func NewOTLPExporter(endPoint string, serviceName string, transport http.RoundTripper) *OTLPExporter {
+	if serviceName == `` {
+		serviceName = DefaultOTLPServiceName
+	}
+	return &OTLPExporter{
+		Endpoint:    MustParseURL(endPoint).String(),
+		ServiceName: serviceName,
+		Client:      &http.Client{Transport: transport},
+	}
+}
+
+// The otlp types below are the subset of the OTLP JSON encoding used by the
+// OTLPExporter. Per the OTLP specification, 64-bit integers are encoded as
+// decimal strings, and trace and span IDs as hexadecimal strings.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key string, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+// randomID returns a random hexadecimal ID of n bytes.
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// otlpSpanFromLog converts a ReportLog to an OTLP span, using now for the
+// timestamps missing from the ReportLog.
+func otlpSpanFromLog(rl ReportLog, now time.Time) otlpSpan {
+	start, end := now, now
+	if rl.StartedAt != 0 {
+		start = time.Unix(0, int64(rl.StartedAt)*int64(time.Millisecond))
+	}
+	if rl.EndedAt != 0 {
+		end = time.Unix(0, int64(rl.EndedAt)*int64(time.Millisecond))
+	}
+
+	name := rl.Method
+	if name == `` {
+		name = `HTTP`
+	}
+	// The ReportLog host is the peer of outbound calls, and the local host of
+	// inbound calls.
+	kind, hostPrefix, errorStatus := otlpSpanKindClient, `net.peer.`, http.StatusBadRequest
+	if rl.Direction == Inbound {
+		kind, hostPrefix, errorStatus = otlpSpanKindServer, `net.host.`, http.StatusInternalServerError
+	}
+	attributes := []otlpKeyValue{
+		otlpString(hostPrefix+`name`, rl.Hostname),
+		otlpInt(hostPrefix+`port`, int64(rl.Port)),
+	}
+	if rl.Protocol != `` {
+		attributes = append(attributes, otlpString(`http.scheme`, rl.Protocol))
+	}
+	if rl.Method != `` {
+		attributes = append(attributes, otlpString(`http.method`, rl.Method))
+	}
+	if rl.URL != `` {
+		attributes = append(attributes, otlpString(`http.url`, rl.URL))
+	}
+	if rl.StatusCode != 0 {
+		attributes = append(attributes, otlpInt(`http.status_code`, int64(rl.StatusCode)))
+	}
+	// gRPC spans are named after the full method, as package.Service/Method.
+	if service, method := path.Split(rl.GRPCMethod); method != `` {
+		name = strings.TrimPrefix(rl.GRPCMethod, `/`)
+		attributes = append(attributes,
+			otlpString(`rpc.system`, `grpc`),
+			otlpString(`rpc.service`, strings.Trim(service, `/`)),
+			otlpString(`rpc.method`, method),
+		)
+	}
+
+	// Spans keep the trace context of the API call, to join the distributed
+	// trace it belongs to.
+	traceID, spanID := rl.TraceID, rl.SpanID
+	if traceID == `` || spanID == `` {
+		traceID, spanID = randomID(16), randomID(8)
+	}
+
+	var status otlpStatus
+	switch {
+	case rl.Type == Error:
+		status = otlpStatus{Code: otlpStatusError, Message: rl.ErrorFullMessage}
+		attributes = append(attributes, otlpString(`error.type`, rl.ErrorCode))
+	// Per the HTTP semantic conventions, 4xx and 5xx are errors for clients,
+	// but only 5xx for servers.
+	case rl.StatusCode >= errorStatus:
+		status = otlpStatus{Code: otlpStatusError}
+		attributes = append(attributes, otlpString(`error.type`, strconv.Itoa(rl.StatusCode)))
+	}
+
+	return otlpSpan{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		ParentSpanID:      rl.ParentSpanID,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        attributes,
+		Status:            status,
+	}
+}
+
+// traces converts a LogReport to an OTLP traces payload. It returns nil if the
+// LogReport does not contain any API call.
+func (e *OTLPExporter) traces(report LogReport) *otlpTraces {
+	now := time.Now()
+	spans := make([]otlpSpan, 0, len(report.Logs))
+	for _, rl := range report.Logs {
+		if rl.Type == Loss || rl.Type == Sampling || rl.Type == Diagnostic {
+			continue
+		}
+		spans = append(spans, otlpSpanFromLog(rl, now))
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	serviceName := e.ServiceName
+	if serviceName == `` {
+		serviceName = DefaultOTLPServiceName
+	}
+	resource := []otlpKeyValue{
+		otlpString(`service.name`, serviceName),
+		otlpString(`telemetry.sdk.language`, report.Agent.Type),
+	}
+	if report.Runtime.Hostname != `` {
+		resource = append(resource, otlpString(`host.name`, report.Runtime.Hostname))
+	}
+	if report.Runtime.Version != `` {
+		resource = append(resource, otlpString(`process.runtime.version`, report.Runtime.Version))
+	}
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: resource},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: OTLPScopeName, Version: report.Agent.Version},
+			Spans: spans,
+		}},
+	}}}
+}
+
+// Export implements the Exporter interface. On failure, the returned error
+// implements Retryable.
+func (e *OTLPExporter) Export(report LogReport) (int, error) {
+	traces := e.traces(report)
+	if traces == nil {
+		return 0, nil
+	}
+	// Cannot fail: the traces are made of basic JSON types.
+	body, _ := json.Marshal(traces)
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, &transmissionError{err: fmt.Errorf("building the OTLP request: %w", err)}
+	}
+	for name, values := range e.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set(ContentTypeHeader, ContentTypeJSON)
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, &transmissionError{err: err, retryable: true}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		// Only the start of the body is reported, so do not read more of it.
+		resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodyLength+1))
+		return 0, &transmissionError{
+			err:        errors.New(responseErrorMessage("got OTLP response "+res.Status, resBody, err)),
+			retryable:  isRetryableStatus(res.StatusCode),
+			retryAfter: parseRetryAfter(res.Header.Get(RetryAfterHeader), time.Now()),
+			statusCode: res.StatusCode,
+			report:     body,
+		}
+	}
+	// Drain the small success responses, so that the connection is reused.
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxDrainedBodyLength))
+	return len(body), nil
+}
@@ -0,0 +1,213 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+// otlpCollectedSpan is the part of an OTLP JSON span checked by tests.
+type otlpCollectedSpan struct {
+	TraceID    string `json:"traceId"`
+	SpanID     string `json:"spanId"`
+	Name       string
+	Kind       int
+	Attributes []struct {
+		Key   string
+		Value map[string]string
+	}
+	Status struct {
+		Code    int
+		Message string
+	}
+}
+
+// attributes flattens the span attributes to their string representation.
+func (s otlpCollectedSpan) attributes() map[string]string {
+	m := make(map[string]string, len(s.Attributes))
+	for _, kv := range s.Attributes {
+		for _, v := range kv.Value {
+			m[kv.Key] = v
+		}
+	}
+	return m
+}
+
+func makeTestCollector(t *testing.T, status int) (*httptest.Server, func() []otlpCollectedSpan) {
+	var m sync.Mutex
+	var spans []otlpCollectedSpan
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != proxy.OTLPTracesPath {
+			t.Errorf(`unexpected path %s`, request.URL.Path)
+		}
+		if ct := request.Header.Get(proxy.ContentTypeHeader); ct != proxy.ContentTypeJSON {
+			t.Errorf(`unexpected content type %s`, ct)
+		}
+		traces := struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpCollectedSpan
+				}
+			}
+		}{}
+		if err := json.NewDecoder(request.Body).Decode(&traces); err != nil {
+			t.Errorf(`decoding OTLP payload: %v`, err)
+		}
+		m.Lock()
+		defer m.Unlock()
+		for _, rs := range traces.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		writer.WriteHeader(status)
+	}))
+	return ts, func() []otlpCollectedSpan {
+		m.Lock()
+		defer m.Unlock()
+		return spans
+	}
+}
+
+func TestOTLPExporter_Export(t *testing.T) {
+	ts, collected := makeTestCollector(t, http.StatusOK)
+	defer ts.Close()
+
+	e := proxy.NewOTLPExporter(ts.URL+proxy.OTLPTracesPath, `test`, nil)
+	report := proxy.MakeConfigReport(`1.0`, `test`, ``)
+	report.Logs = []proxy.ReportLog{
+		{
+			Type: proxy.End, Method: http.MethodGet, URL: `https://example.com/path`, StatusCode: 404,
+			Hostname: `example.com`, Port: 443, Protocol: `https`, StartedAt: 1000, EndedAt: 2000,
+		},
+		{
+			Type: proxy.Error, Method: http.MethodPost, Hostname: `example.org`, Port: 80,
+			ErrorCode: `boom`, ErrorFullMessage: `boom happened`,
+		},
+		proxy.NewReportLossReport(1),
+	}
+	size, err := e.Export(report)
+	if err != nil {
+		t.Fatalf(`Export() error: %v`, err)
+	}
+	if size == 0 {
+		t.Errorf(`Export() returned a 0 size`)
+	}
+
+	spans := collected()
+	if len(spans) != 2 {
+		t.Fatalf(`got %d spans, want 2`, len(spans))
+	}
+	for _, span := range spans {
+		if len(span.TraceID) != 32 || len(span.SpanID) != 16 || span.Kind != 3 {
+			t.Errorf(`ill-formed span %+v`, span)
+		}
+	}
+
+	wantAttributes := map[string]string{
+		`http.method`:      `GET`,
+		`http.url`:         `https://example.com/path`,
+		`http.scheme`:      `https`,
+		`http.status_code`: `404`,
+		`net.peer.name`:    `example.com`,
+		`net.peer.port`:    `443`,
+		`error.type`:       `404`,
+	}
+	if got := spans[0].attributes(); !reflect.DeepEqual(got, wantAttributes) {
+		t.Errorf(`got attributes %v, want %v`, got, wantAttributes)
+	}
+	if spans[0].Name != http.MethodGet || spans[0].Status.Code != 2 {
+		t.Errorf(`got name %s, status %d, want GET, 2`, spans[0].Name, spans[0].Status.Code)
+	}
+	if spans[1].Status.Code != 2 || spans[1].Status.Message != `boom happened` {
+		t.Errorf(`got status %+v, want error with message`, spans[1].Status)
+	}
+}
+
+func TestOTLPExporter_ExportKinds(t *testing.T) {
+	ts, collected := makeTestCollector(t, http.StatusOK)
+	defer ts.Close()
+
+	e := proxy.NewOTLPExporter(ts.URL+proxy.OTLPTracesPath, `test`, nil)
+	report := proxy.MakeConfigReport(`1.0`, `test`, ``)
+	report.Logs = []proxy.ReportLog{
+		{
+			Type: proxy.End, Direction: proxy.Inbound, Method: http.MethodGet, StatusCode: 404,
+			Hostname: `api.example.com`, Port: 443,
+		},
+		{
+			Type: proxy.End, Method: http.MethodPost, StatusCode: 200, Hostname: `grpc.example.com`, Port: 443,
+			GRPCMethod: `/pkg.Service/Method`, GRPCStatus: `OK`,
+		},
+	}
+	if _, err := e.Export(report); err != nil {
+		t.Fatalf(`Export() error: %v`, err)
+	}
+
+	spans := collected()
+	if len(spans) != 2 {
+		t.Fatalf(`got %d spans, want 2`, len(spans))
+	}
+	// Per the HTTP server semantic conventions, 4xx are not errors.
+	inbound := spans[0]
+	if inbound.Kind != 2 || inbound.Status.Code != 0 || inbound.attributes()[`net.host.name`] != `api.example.com` {
+		t.Errorf(`ill-formed inbound span %+v`, inbound)
+	}
+	grpc := spans[1]
+	if grpc.Name != `pkg.Service/Method` || grpc.attributes()[`rpc.service`] != `pkg.Service` ||
+		grpc.attributes()[`rpc.method`] != `Method` {
+		t.Errorf(`ill-formed gRPC span %+v`, grpc)
+	}
+}
+
+func TestOTLPExporter_ExportFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantRetryable bool
+	}{
+		{`retryable`, http.StatusServiceUnavailable, true},
+		{`permanent`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _ := makeTestCollector(t, tt.status)
+			defer ts.Close()
+
+			e := proxy.NewOTLPExporter(ts.URL+proxy.OTLPTracesPath, ``, nil)
+			report := proxy.LogReport{Logs: []proxy.ReportLog{{Type: proxy.End}}}
+			_, err := e.Export(report)
+			r, ok := err.(proxy.Retryable)
+			if !ok {
+				t.Fatalf(`got error %v, want a Retryable error`, err)
+			}
+			if r.Retryable() != tt.wantRetryable {
+				t.Errorf(`got retryable %t, want %t`, r.Retryable(), tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestOTLPExporter_ExportFailureBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(strings.Repeat(`x`, 1<<20)))
+	}))
+	defer ts.Close()
+
+	e := proxy.NewOTLPExporter(ts.URL+proxy.OTLPTracesPath, ``, nil)
+	_, err := e.Export(proxy.LogReport{Logs: []proxy.ReportLog{{Type: proxy.End}}})
+	if err == nil {
+		t.Fatal(`Export() succeeded, want an error`)
+	}
+	want := `got OTLP response 400 Bad Request: ` + strings.Repeat(`x`, 256) + `...`
+	if err.Error() != want {
+		t.Errorf(`Export() error has length %d, want %d`, len(err.Error()), len(want))
+	}
+}
@@ -3,13 +3,12 @@
 package proxy
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -18,13 +17,16 @@ import (
 const (
 	// AckBacklog is the capacity of the log write acknowledgments channel.
 	AckBacklog = 1000
-	// QuietLoopPause is the duration of the pause the Start loop will enter
-	// if no I/O is available, to avoid consuming too much power by tight looping.
-	QuietLoopPause = 10 * time.Millisecond
+	// DefaultWorkers is the default number of goroutines transmitting batches
+	// of ReportLog elements concurrently.
+	DefaultWorkers = 4
 	// FanInBacklog is the capacity of the fan-in log write channel
 	FanInBacklog = 100
 	// DrainingTimeout is how long to wait for draining before giving up
 	DrainingTimeout = 20 * time.Second
+	// DefaultSummaryInterval is the period at which the loss, sampling, and
+	// diagnostic reports are transmitted when batching is disabled.
+	DefaultSummaryInterval = 1 * time.Second
 
 	// End is the ReportLog Type for successful API calls.
 	End = `REQUEST_END`
@@ -32,6 +34,17 @@ const (
 	Error = `REQUEST_ERROR`
 	// Loss is the ReportLog Type for synthetic reports warning of reports loss.
 	Loss = `REPORT_LOSS`
+	// Sampling is the ReportLog Type for synthetic reports counting API calls
+	// sampled out instead of being reported.
+	Sampling = `REPORT_SAMPLING`
+	// Diagnostic is the ReportLog Type for synthetic reports counting internal
+	// agent errors, like listener failures.
+	Diagnostic = `AGENT_DIAGNOSTIC`
+
+	// Outbound is the ReportLog Direction for API calls made by the application.
+	Outbound = `OUTBOUND`
+	// Inbound is the ReportLog Direction for API calls served by the application.
+	Inbound = `INBOUND`
 
 	// AuthorizationHeader is the canonical Authorization header name.
 	AuthorizationHeader = `Authorization`
@@ -39,6 +52,9 @@ const (
 	// AcceptHeader is the canonical Accept header name.
 	AcceptHeader = `Accept`
 
+	// RetryAfterHeader is the canonical Retry-After header name.
+	RetryAfterHeader = `Retry-After`
+
 	// ContentTypeHeader is the canonical content type header name.
 	ContentTypeHeader = `Content-Type`
 
@@ -90,30 +106,91 @@ type Sender struct {
 	// Acks receives the acknowledgments from the HTTP sending the marshaled
 	// ReportLog elements to the Bearer platform.
 	//
-	// In this version, each element has value 1. When sending gets to be batched
-	// in a later version, this value will represent the number of acknowledged
-	// LogReport elements actually transmitted.
+	// Each element is the number of ReportLog elements in the acknowledged
+	// LogReport batch, whether its transmission succeeded or not.
 	Acks chan uint
 
-	// InFlight is the number of ReportLog elements awaiting delivery to the
-	// Bearer platform.
-	InFlight uint
+	// stats records the Sender activity, for reporting by Stats.
+	stats senderStats
+
+	// replaying is 1 while spooled ReportLog elements are being replayed. It is
+	// accessed atomically.
+	replaying int32
+
+	// pending holds the ReportLog elements accepted by the background sending
+	// loop but not yet handed over for transmission. It is only accessed by
+	// the background sending loop.
+	pending []ReportLog
 
-	// Lost is the number of lost and never sent ReportLog elements. It is reset
-	// to 0 when transmission resumes.
-	Lost uint
+	// ready holds the batches handed over for transmission but not yet taken
+	// by a worker. It is only accessed by the background sending loop.
+	ready [][]ReportLog
 
-	// Counter is the total number of records handled.
-	Counter uint
+	// shed indexes the ReportLog elements of the pending and ready batches for
+	// eviction. It is only accessed by the background sending loop.
+	shed shedIndex
+
+	// work transmits the ready batches from the background sending loop to
+	// the workers.
+	work chan []ReportLog
+
+	// linger is the timer bounding the time the oldest pending ReportLog
+	// element may wait before the pending batch is flushed. It is nil when
+	// there are no pending elements.
+	linger *time.Timer
 
 	// Configuration fields below.
 
-	// InflightLimit is the maximum value of Inflight before bandwidth reduction
-	// is triggered. When InFlight exceeds this value, extra ReportLog elements
-	// are dropped, only counting the number of lost elements, to avoid saturation
-	// of the client process and network.
+	// InflightLimit is the maximum number of ReportLog elements in flight before
+	// bandwidth reduction is triggered. When it is reached, extra ReportLog
+	// elements are dropped, only counting the number of lost elements per
+	// ReportClass, to avoid saturation of the client process and network.
+	// Elements of a higher ReportClass replace those of a lower one if they
+	// have not been taken by a worker yet.
 	InFlightLimit uint
 
+	// Workers is the number of goroutines transmitting batches concurrently,
+	// started by Start. A zero value means a single worker.
+	Workers uint
+
+	// BatchSize is the maximum number of ReportLog elements transmitted in a
+	// single LogReport. Values of 0 or 1 disable batching.
+	BatchSize uint
+
+	// BatchLinger is the maximum duration a ReportLog element may wait for a
+	// batch to fill up before the batch is transmitted anyway. A zero value
+	// disables batching.
+	BatchLinger time.Duration
+
+	// MaxRetries is the maximum number of times a LogReport transmission is
+	// retried after a retryable failure: connection errors, HTTP 408, 429 and
+	// 5xx responses. A zero value disables retries.
+	MaxRetries uint
+
+	// RetryBaseDelay is the delay before the first retry. It doubles for each
+	// further retry, with random jitter.
+	RetryBaseDelay time.Duration
+
+	// RetryMaxDelay is the upper bound of the delay between retries, including
+	// delays requested by the report server in a Retry-After header.
+	RetryMaxDelay time.Duration
+
+	// Spool, if not nil, receives the ReportLog elements which cannot be
+	// transmitted, either because InFlightLimit is reached, or because the
+	// report server cannot be reached, instead of dropping them. They are
+	// transmitted again when the Sender starts and after any successful
+	// transmission.
+	Spool *Spool
+
+	// Exporter is the destination of the LogReport values built by the Sender.
+	// If nil, LogReport values are transmitted to the Bearer platform at
+	// LogEndpoint, using the Sender http.Client.
+	Exporter Exporter
+
+	// Compression is the Content-Encoding applied to the LogReport payloads
+	// transmitted to LogEndpoint when Exporter is nil.
+	Compression string
+
 	// LogEndpoint is the URL of the Bearer host receiving the logs.
 	LogEndpoint string
 
@@ -130,6 +207,16 @@ type Sender struct {
 	*zerolog.Logger
 }
 
+// Stats returns a snapshot of the Sender activity. It is safe for concurrent use.
+func (s *Sender) Stats() Stats {
+	st := s.stats.snapshot()
+	st.Queued = uint64(len(s.FanIn))
+	if s.Spool != nil {
+		st.Spooled = uint64(s.Spool.Len())
+	}
+	return st
+}
+
 // Stop notifies the background sending loop that the application is shutting
 // down. It will then block waiting for any remaining reports to be sent. If
 // the DrainingTimeout is reached then it will stop sending any further logs.
@@ -156,6 +243,8 @@ func NewSender(
 		Draining:        make(chan struct{}),
 		ForceFinish:     make(chan struct{}),
 		InFlightLimit:   limit,
+		Workers:         DefaultWorkers,
+		BatchSize:       1,
 		LogEndpoint:     MustParseURL(endPoint).String(),
 		EnvironmentType: environmentType,
 		SecretKey:       secretKey,
@@ -168,94 +257,136 @@ func NewSender(
 
 // Send sends a ReportLog element to the FanIn channel for transmission.
 // It should not be called after Stop.
+//
+// Send never blocks: if the FanIn backlog is full, the ReportLog is counted
+// as lost instead of slowing down the application.
 func (s *Sender) Send(log ReportLog) {
 	select {
 	case <-s.Draining:
 		s.Warn().Msg(`sending attempted after Stop: ignored`)
 		return
 	default:
-		s.FanIn <- log
+	}
+	select {
+	case s.FanIn <- log:
+	default:
+		s.stats.lose(Classify(log), 1)
 	}
 }
 
-// Start configures and starts the background sending loop.
+// Start configures and starts the background sending loop, and the Workers
+// goroutines transmitting the batches it prepares.
 func (s *Sender) Start() {
 	defer func() {
 		close(s.Done)
 	}()
 
+	workers := s.Workers
+	if workers == 0 {
+		workers = 1
+	}
+	s.work = make(chan []ReportLog)
+	defer close(s.work)
+	for i := uint(0); i < workers; i++ {
+		go s.worker()
+	}
+
+	// Transmit ReportLog elements left over in the spool by a previous run.
+	if s.Spool != nil && s.Spool.Len() > 0 {
+		go s.replay()
+	}
+
+	// Summaries of sampled out calls and diagnostics are transmitted at least
+	// once per linger period, even without any other report to send.
+	summaries := time.NewTicker(s.summaryInterval())
+	defer summaries.Stop()
+
 	// Normal operation.
 Normal:
 	for {
 		select {
 		// Finish received: switch to Finishing mode.
 		case <-s.Finish:
-			s.Logger.Trace().Msgf("Sender switching to Finishing mode at counter %d.", s.Counter)
+			s.Logger.Trace().Msgf("Sender switching to Finishing mode at counter %d.", s.counter())
 			break Normal
 
 		// ReportLog to write.
 		case rl, ok := <-s.FanIn:
 			if !ok {
-				s.Logger.Trace().Msgf("Sender switching to Finishing mode on FanIn close, at counter %d.", s.Counter)
+				s.Logger.Trace().Msgf("Sender switching to Finishing mode on FanIn close, at counter %d.", s.counter())
 				break Normal
 			}
 			s.Logger.Trace().Msg("Sender received log to send.")
-			if s.InFlight >= s.InFlightLimit {
-				s.Lost++
-				continue
-			}
-			s.InFlight++
-			go s.WriteLog(rl)
+			s.enqueue(rl)
+
+		// Oldest pending ReportLog waited long enough.
+		case <-s.lingerC():
+			s.flush()
+
+		// Summaries may have been waiting for an acknowledgment long enough.
+		case <-summaries.C:
+			s.reportSummaries()
+
+		// A worker is available for the oldest ready batch.
+		case s.workC() <- s.nextBatch():
+			s.ready = s.ready[1:]
+			s.shed.take()
 
 		// Acknowledgment of ReportLog written.
 		case n := <-s.Acks:
 			s.Logger.Trace().Msg("Sender received ack.")
 			if n == 0 {
-				s.Error().Msgf("received an acknowledgment for 0 report at counter %d", s.Counter)
+				s.Error().Msgf("received an acknowledgment for 0 report at counter %d", s.counter())
 				continue
 			}
-			if n > s.InFlight {
+			if acked := s.stats.acknowledge(uint64(n)); acked < uint64(n) {
 				// This should never happen, except for bugs.
 				s.Error().Msgf(`%d reports acknowledged at counter %d, but only %d were in flight`,
-					n, s.Counter, s.InFlight)
-				n = s.InFlight
-			}
-			// First window of opportunity to transmit a loss report.
-			s.InFlight -= n
-			if s.Lost > 0 {
-				s.InFlight++
-				go s.WriteLog(NewReportLossReport(s.Lost))
-				s.Lost = 0
-			}
-		default:
-			// Go tight loops may be sub-microsecond, so if nothing is going on,
-			// avoid a tight loop to save energy.
-			if len(s.FanIn) == 0 && len(s.Acks) == 0 {
-				time.Sleep(QuietLoopPause)
+					n, s.counter(), acked)
 			}
+			// First window of opportunity to transmit loss and sampling reports.
+			s.reportSummaries()
 		}
 	}
 
 	close(s.Draining)
+	s.flush()
+	s.reportSummaries()
 
 	// Finishing.
 	for {
-		if len(s.FanIn) == 0 && s.InFlight == 0 {
-			return
+		if len(s.FanIn) == 0 && s.stats.inFlight() == 0 {
+			// Last chance for the API calls sampled out or diagnosed while
+			// finishing.
+			s.reportSampling()
+			s.reportDiagnostics()
+			if s.stats.inFlight() == 0 {
+				return
+			}
 		}
 		select {
 		case <-s.ForceFinish:
-			s.Logger.Warn().Msgf("did not complete in time, dropping %d remaining reports", len(s.FanIn))
+			s.Logger.Warn().Msgf("did not complete in time, dropping %d remaining reports",
+				len(s.FanIn)+len(s.pending)+s.readyLen())
 			return
-		// ReportLog to write. Same as normal operation.
+		// ReportLog to write. Same as normal operation, but do not wait for
+		// batches to fill up once there is nothing more to read.
 		case rl := <-s.FanIn:
 			s.Logger.Trace().Msg("Finishing sender received log.")
-			if s.InFlight >= s.InFlightLimit {
-				s.Lost++
-				continue
+			s.enqueue(rl)
+			if len(s.FanIn) == 0 {
+				s.flush()
 			}
-			s.InFlight++
-			go s.WriteLog(rl)
+
+		case <-s.lingerC():
+			s.flush()
+
+		case <-summaries.C:
+			s.reportSummaries()
+
+		case s.workC() <- s.nextBatch():
+			s.ready = s.ready[1:]
+			s.shed.take()
 
 		case n := <-s.Acks:
 			s.Logger.Trace().Msg("Finishing sender received ack.")
@@ -263,70 +394,360 @@ Normal:
 				s.Error().Msg("received an acknowledgment in finishing phase but for 0 report")
 				continue
 			}
-			if n > s.InFlight {
+			if acked := s.stats.acknowledge(uint64(n)); acked < uint64(n) {
 				// This should never happen, except for bugs.
-				s.Error().Msgf(`%d reports acknowledged in finishing phase, but only %d were in flight`, n, s.InFlight)
-				n = s.InFlight
-			}
-			s.InFlight -= n
-			if s.Lost > 0 {
-				s.InFlight++
-				go s.WriteLog(NewReportLossReport(s.Lost))
-				s.Lost = 0
+				s.Error().Msgf(`%d reports acknowledged in finishing phase, but only %d were in flight`, n, acked)
 			}
+			s.reportSummaries()
 		}
 	}
 }
 
-// WriteLog attempts to transmit a ReportLog to the Bearer platform, and acknowleges
-// it finished its attempt, whether it succeeded or not.
+// enqueue adds a ReportLog to the pending batch and flushes the batch once it
+// is full.
+//
+// If too many ReportLog elements are already in flight, the ReportLog replaces
+// a ReportLog of a lower class not yet taken by a worker, if any. The shed
+// ReportLog, either the replaced one or the enqueued one, is spooled or lost.
+func (s *Sender) enqueue(rl ReportLog) {
+	if s.stats.inFlight() >= uint64(s.InFlightLimit) {
+		if evicted, ok := s.evict(rl); ok {
+			rl = evicted
+		}
+		if !s.spool([]ReportLog{rl}) {
+			s.stats.lose(Classify(rl), 1)
+		}
+		return
+	}
+	s.stats.accept(1)
+	if s.pending == nil {
+		// The indexed elements must not move, so the batch is never grown.
+		s.pending = make([]ReportLog, 0, s.batchCap())
+	}
+	s.pending = append(s.pending, rl)
+	s.shed.add(&s.pending[len(s.pending)-1])
+	if len(s.pending) >= s.batchCap() {
+		s.flush()
+		return
+	}
+	if s.linger == nil {
+		s.linger = time.NewTimer(s.BatchLinger)
+	}
+}
+
+// batchCap returns the largest number of ReportLog elements in a pending batch.
+func (s *Sender) batchCap() int {
+	if s.BatchSize <= 1 || s.BatchLinger <= 0 {
+		return 1
+	}
+	return int(s.BatchSize)
+}
+
+// summaryInterval returns the period at which the summary reports are
+// transmitted without other activity: BatchLinger, or DefaultSummaryInterval if
+// batching is disabled.
+func (s *Sender) summaryInterval() time.Duration {
+	if s.BatchLinger > 0 {
+		return s.BatchLinger
+	}
+	return DefaultSummaryInterval
+}
+
+// reportSummaries transmits the loss, sampling, and diagnostic reports, if
+// there is anything to report since the previous ones.
+func (s *Sender) reportSummaries() {
+	s.reportLoss()
+	s.reportSampling()
+	s.reportDiagnostics()
+}
+
+// reportLoss transmits a loss report if ReportLog elements were lost since the
+// previous loss report.
+func (s *Sender) reportLoss() {
+	lost := s.stats.takeUnreported()
+	total := lost.total()
+	if total == 0 {
+		return
+	}
+	rl := NewReportLossReport(uint(total))
+	rl.Losses = lost.byName()
+	s.stats.accept(1)
+	s.ready = append(s.ready, []ReportLog{rl})
+	s.shed.ready(false)
+}
+
+// reportSampling transmits a sampling report if API calls were sampled out
+// since the previous sampling report.
+func (s *Sender) reportSampling() {
+	sampled := s.stats.takeSampledOut()
+	if len(sampled) == 0 {
+		return
+	}
+	s.stats.accept(1)
+	s.ready = append(s.ready, []ReportLog{NewSamplingReport(sampled)})
+	s.shed.ready(false)
+}
+
+// reportDiagnostics transmits a diagnostic report if internal agent errors
+// happened since the previous diagnostic report.
+func (s *Sender) reportDiagnostics() {
+	diagnostics := s.stats.takeDiagnostics()
+	if len(diagnostics) == 0 {
+		return
+	}
+	s.stats.accept(1)
+	s.ready = append(s.ready, []ReportLog{NewDiagnosticReport(diagnostics)})
+	s.shed.ready(false)
+}
+
+// Diagnose records an internal agent error which happened at the given stage
+// of an API call, like a listener failure. Such errors are not errors of the
+// API call, and are reported separately. It is safe for concurrent use.
+func (s *Sender) Diagnose(stage Stage, err error) {
+	if err == nil {
+		return
+	}
+	s.Debug().Err(err).Str(`stage`, string(stage)).Msg(`agent error diverted from API call.`)
+	s.stats.diagnose(stage, err)
+}
+
+// SampleOut records an API call to host which was sampled out instead of
+// being reported. It is safe for concurrent use.
+func (s *Sender) SampleOut(host string) {
+	s.stats.sampleOut(host)
+}
+
+// counter returns the total number of ReportLog elements handled, whether
+// their export succeeded or failed.
+func (s *Sender) counter() uint64 {
+	st := s.stats.snapshot()
+	return st.Sent + st.Failed
+}
+
+// flush makes the pending batch ready for transmission, if it is not empty.
+func (s *Sender) flush() {
+	if s.linger != nil {
+		s.linger.Stop()
+		s.linger = nil
+	}
+	if len(s.pending) == 0 {
+		return
+	}
+	s.ready = append(s.ready, s.pending)
+	s.shed.ready(true)
+	s.pending = nil
+}
+
+// worker transmits the batches received from the background sending loop,
+// until Start closes the work channel.
+func (s *Sender) worker() {
+	for batch := range s.work {
+		s.WriteLogs(batch)
+	}
+}
+
+// workC returns the work channel if a batch is ready for transmission, or nil
+// otherwise, in which case sending to it blocks forever.
+func (s *Sender) workC() chan<- []ReportLog {
+	if len(s.ready) == 0 {
+		return nil
+	}
+	return s.work
+}
+
+// nextBatch returns the oldest ready batch, or nil if there is none.
+func (s *Sender) nextBatch() []ReportLog {
+	if len(s.ready) == 0 {
+		return nil
+	}
+	return s.ready[0]
+}
+
+// readyLen returns the number of ReportLog elements in the ready batches.
+func (s *Sender) readyLen() int {
+	n := 0
+	for _, batch := range s.ready {
+		n += len(batch)
+	}
+	return n
+}
+
+// lingerC returns the channel of the linger timer, or nil if there is no
+// pending batch, in which case receiving from it blocks forever.
+func (s *Sender) lingerC() <-chan time.Time {
+	if s.linger == nil {
+		return nil
+	}
+	return s.linger.C
+}
+
+// WriteLog attempts to transmit a single ReportLog to the Bearer platform.
+// It is a convenience wrapper around WriteLogs.
 func (s *Sender) WriteLog(rl ReportLog) {
+	s.WriteLogs([]ReportLog{rl})
+}
+
+// WriteLogs attempts to transmit a batch of ReportLog elements to the Bearer
+// platform as a single LogReport, and acknowledges it finished its attempt,
+// whether it succeeded or not.
+//
+// Retryable failures are retried up to MaxRetries times, with exponential
+// backoff. Batches failing permanently are counted as lost.
+func (s *Sender) WriteLogs(logs []ReportLog) {
+	n := uint(len(logs))
 	defer func() {
-		var n uint = 1
 		// The attempt was made, the request is no longer outstanding even if it failed.
 		s.Acks <- n
-		s.Counter += n
 	}()
 
+	report := s.makeReport(logs)
+	exporter := s.exporter()
+	for attempt := uint(0); ; attempt++ {
+		size, err := exporter.Export(report)
+		if err == nil {
+			s.stats.succeed(uint64(n), size)
+			s.Trace().
+				Uint64("reportId", s.counter()).
+				Int("batchSize", len(logs)).
+				Uint("attempt", attempt).
+				Send()
+			// The destination is reachable: transmit any spooled logs.
+			if s.Spool != nil && s.Spool.Len() > 0 {
+				go s.replay()
+			}
+			return
+		}
+
+		var r Retryable
+		retryable := errors.As(err, &r) && r.Retryable()
+		var te *transmissionError
+		_ = errors.As(err, &te)
+		if retryable && attempt < s.MaxRetries {
+			var retryAfter time.Duration
+			if te != nil {
+				retryAfter = te.retryAfter
+			}
+			s.stats.recordError(err)
+			delay := s.retryDelay(attempt, retryAfter)
+			s.Debug().Err(err).Uint("attempt", attempt).Dur("delay", delay).
+				Msgf(`retrying transmission of %d logs to the report server.`, n)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-s.ForceFinish:
+			}
+		}
+
+		// Failures of a reachable report server are not expected to resolve
+		// themselves, so only retryable failures are spooled.
+		if retryable && s.spool(logs) {
+			s.Debug().Err(err).Msgf(`spooled %d logs after failed transmission.`, n)
+			return
+		}
+		s.stats.fail(logs, err)
+		ev := s.Warn().Err(err).Int("batchSize", len(logs))
+		if te != nil && te.statusCode != 0 {
+			ev = ev.RawJSON("report", te.report)
+			if te.responseBody != nil {
+				ev = ev.RawJSON("logs body", te.responseBody)
+			}
+		}
+		ev.Msgf(`transmitting logs at counter %d to the report server.`, s.counter())
+		return
+	}
+}
+
+// exporter returns the Exporter used by the Sender, defaulting to an
+// HTTPExporter built from the Sender fields.
+func (s *Sender) exporter() Exporter {
+	if s.Exporter != nil {
+		return s.Exporter
+	}
+	return &HTTPExporter{
+		Endpoint:    s.LogEndpoint,
+		SecretKey:   s.SecretKey,
+		Client:      &s.Client,
+		Compression: s.Compression,
+	}
+}
+
+// makeReport builds a LogReport containing the passed logs.
+func (s *Sender) makeReport(logs []ReportLog) LogReport {
 	lr := MakeConfigReport(s.Version, s.EnvironmentType, s.SecretKey)
 	lr.SecretKey = s.SecretKey
-	lr.Logs = []ReportLog{rl}
-
-	// Cannot fail: the LogReport is made of basic JSON types.
-	body, _ := json.Marshal(lr)
+	lr.Logs = logs
+	return lr
+}
 
-	req, err := http.NewRequest(http.MethodPost, s.LogEndpoint, bytes.NewReader(body))
+// spool attempts to store ReportLog elements in the Spool, if there is one. It
+// returns true if the elements were stored. Elements dropped by the Spool to
+// make room for them are counted as failed.
+func (s *Sender) spool(logs []ReportLog) bool {
+	if s.Spool == nil {
+		return false
+	}
+	dropped, err := s.Spool.Write(logs)
 	if err != nil {
-		s.Warn().Err(err).Msg(`error building the log request`)
+		s.Warn().Err(err).Msgf(`spooling %d logs.`, len(logs))
+		return false
+	}
+	if dropped > 0 {
+		s.stats.lose(ClassUnknown, uint64(dropped))
+	}
+	return true
+}
+
+// replay transmits the spooled ReportLog elements, oldest first, until the
+// Spool is empty, a transmission fails, or the Sender starts draining. Only
+// one replay runs at any given time.
+func (s *Sender) replay() {
+	if !atomic.CompareAndSwapInt32(&s.replaying, 0, 1) {
 		return
 	}
-	req.Header.Add(AuthorizationHeader, s.SecretKey)
-	req.Header.Add(AcceptHeader, ContentTypeJSON)
-	req.Header.Set(ContentTypeHeader, FullContentTypeJSON)
-	res, err := s.Client.Do(req)
+	defer atomic.StoreInt32(&s.replaying, 0)
 
-	if err != nil {
-		s.Warn().Err(err).Msgf(`transmitting log %d to the report server.`, s.Counter)
-	} else {
-		if res.StatusCode < http.StatusContinue || res.StatusCode >= http.StatusBadRequest {
-			logsBody, err := ioutil.ReadAll(res.Body)
-			if len(logsBody) == 0 {
-				logsBody = []byte(`[]`)
+	batchSize := int(s.BatchSize)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	exporter := s.exporter()
+	for {
+		select {
+		case <-s.Draining:
+			return
+		default:
+		}
+		logs, commit, err := s.Spool.Take()
+		if err != nil {
+			s.Warn().Err(err).Msg(`reading spooled logs.`)
+			return
+		}
+		if commit == nil {
+			return
+		}
+		sent := 0
+		for sent < len(logs) {
+			end := sent + batchSize
+			if end > len(logs) {
+				end = len(logs)
+			}
+			var size int
+			if size, err = exporter.Export(s.makeReport(logs[sent:end])); err != nil {
+				s.stats.recordError(err)
+				break
 			}
-			s.Warn().
-				RawJSON("report", body).
-				Err(err).
-				RawJSON("logs body", logsBody).
-				Msgf(`got response %d %s transmitting log %d to the report server.`, res.StatusCode, res.Status, s.Counter)
+			s.stats.succeed(uint64(end-sent), size)
+			sent = end
+		}
+		if cErr := commit(sent); cErr != nil {
+			s.Warn().Err(cErr).Msg(`committing spooled logs.`)
+			return
+		}
+		s.Trace().Msgf(`replayed %d spooled logs out of %d.`, sent, len(logs))
+		if err != nil {
+			s.Debug().Err(err).Msg(`replaying spooled logs.`)
 			return
 		}
-		resBody, _ := ioutil.ReadAll(res.Body)
-		s.Trace().
-			Uint("reportId", s.Counter).
-			Str("status", res.Status).
-			RawJSON("report", body).
-			Bytes("response", resBody).
-			Send()
 	}
 }
 
@@ -340,9 +761,45 @@ func NewReportLossReport(n uint) ReportLog {
 	}
 }
 
+// NewSamplingReport creates an off-API ReportLog for API calls sampled out,
+// counted per host.
+func NewSamplingReport(sampledOut map[string]uint) ReportLog {
+	var n uint
+	for _, count := range sampledOut {
+		n += count
+	}
+	return ReportLog{
+		Type:             Sampling,
+		Stage:            StageUndefined,
+		ErrorFullMessage: fmt.Sprintf("%d API calls were sampled out", n),
+		SampledOut:       sampledOut,
+	}
+}
+
+// NewDiagnosticReport creates an off-API ReportLog for internal agent errors,
+// counted per stage and error message.
+func NewDiagnosticReport(diagnostics map[string]uint) ReportLog {
+	var n uint
+	for _, count := range diagnostics {
+		n += count
+	}
+	return ReportLog{
+		Type:             Diagnostic,
+		Stage:            StageUndefined,
+		ErrorFullMessage: fmt.Sprintf("%d agent errors happened", n),
+		Diagnostics:      diagnostics,
+	}
+}
+
 // ReportLog is the report summarizing an API call.
 type ReportLog struct {
-	LogLevel string `json:"logLevel"`
+	LogLevel  string `json:"logLevel"`
+	Direction string `json:"direction,omitempty"` // Outbound or Inbound
+
+	// W3C Trace Context IDs, as lowercase hexadecimal digits, if known.
+	TraceID      string `json:"traceId,omitempty"`
+	SpanID       string `json:"spanId,omitempty"`
+	ParentSpanID string `json:"parentSpanId,omitempty"`
 
 	// Common, except for Detected level.
 
@@ -351,12 +808,15 @@ type ReportLog struct {
 	Type                      string                      `json:"type,omitempty"`      // REQUEST_END on success, REQUEST_ERROR on connection errors
 	Stage                     string                      `json:"stageType,omitempty"`
 	ActiveDataCollectionRules *[]ReportDataCollectionRule `json:"activeDataCollectionRules,omitempty"` // More compact than sending the complete rule.
+	Timings                   *ReportTimings              `json:"timings,omitempty"`
 
 	// filters.StageConnect
 
 	Port     uint16 `json:"port"`
 	Protocol string `json:"protocol"` // Scheme: http[s]
 	Hostname string `json:"hostname"`
+	// TLS is only set for TLS connections.
+	TLS *ReportTLS `json:"tls,omitempty"`
 
 	// filters.StageRequest
 
@@ -369,6 +829,9 @@ type ReportLog struct {
 
 	ResponseHeaders http.Header `json:"responseHeaders"`
 	StatusCode      int         `json:"statusCode,omitempty"`
+	// Hijacked is set for served API calls whose connection was taken over by
+	// the handler, in which case StatusCode is only known if it was written.
+	Hijacked bool `json:"hijacked,omitempty"`
 
 	// filters.StageBodies. Note that these 4 may very well NOT be valid strings.
 	RequestBody  string `json:"requestBody,omitempty"`
@@ -376,10 +839,47 @@ type ReportLog struct {
 	// Payload SHAs
 	RequestBodyPayloadSHA  string `json:"requestBodyPayloadSha,omitempty"`
 	ResponseBodyPayloadSHA string `json:"responseBodyPayloadSha,omitempty"`
+	// Truncated bodies: the body fields only contain a prefix of a body, whose
+	// actual length is given, or a lower bound of it if it was not declared.
+	RequestBodyTruncated  bool  `json:"requestBodyTruncated,omitempty"`
+	RequestBodyLength     int64 `json:"requestBodyLength,omitempty"`
+	ResponseBodyTruncated bool  `json:"responseBodyTruncated,omitempty"`
+	ResponseBodyLength    int64 `json:"responseBodyLength,omitempty"`
+
+	// gRPC calls: the full method name, and the status code name.
+	GRPCMethod string `json:"grpcMethod,omitempty"`
+	GRPCStatus string `json:"grpcStatus,omitempty"`
 
 	// Error
 	ErrorCode        string `json:"errorCode,omitempty"`
 	ErrorFullMessage string `json:"errorFullMessage,omitempty"`
+
+	// Loss: the number of lost ReportLog elements per ReportClass name.
+	Losses map[string]uint `json:"losses,omitempty"`
+
+	// Sampling
+
+	// SampleRate is the rate at which API calls like this one were sampled,
+	// in the ]0, 1[ interval, or 0 if they were not sampled.
+	SampleRate float64 `json:"sampleRate,omitempty"`
+	// SampledOut is the number of API calls sampled out per host.
+	SampledOut map[string]uint `json:"sampledOut,omitempty"`
+
+	// Diagnostic: the number of internal agent errors per "stage: message".
+	Diagnostics map[string]uint `json:"diagnostics,omitempty"`
+}
+
+// ReportTimings is the breakdown of the duration of an API call, in
+// milliseconds. Phases which did not happen, like the DNS lookup and connection
+// on reused connections, are omitted.
+type ReportTimings struct {
+	DNSLookup    float64 `json:"dnsLookup,omitempty"`
+	TCPConnect   float64 `json:"tcpConnect,omitempty"`
+	TLSHandshake float64 `json:"tlsHandshake,omitempty"`
+	// FirstByte and BodyDone are measured from the start of the API call.
+	FirstByte        float64 `json:"timeToFirstByte,omitempty"`
+	BodyDone         float64 `json:"bodyDone,omitempty"`
+	ConnectionReused bool    `json:"connectionReused"`
 }
 
 // ReportDataCollectionRule is a subset of a DataCollectionRule used to report
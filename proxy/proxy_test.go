@@ -2,14 +2,17 @@ package proxy_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -120,22 +123,58 @@ func TestSender_Send(t *testing.T) {
 
 func TestSender_StartHappyAck(t *testing.T) {
 	sender, builder := makeTestSender()
-	sender.InFlight = 1
+	sender.Exporter = proxy.NewMemoryExporter()
 	go sender.Start()
-	sender.Acks <- 1
-	// Ensure at least one loop iteration.
-	time.Sleep(1 * proxy.QuietLoopPause)
-	l := len(strings.Split(builder.String(), "\n"))
-	if l != 2 {
-		t.Errorf("sender did not log ack. Expected %d lines, got %d", 1, l-1)
+	sender.Send(proxy.ReportLog{})
+	// Ensure the ack has been processed.
+	waitFor(t, func() bool { st := sender.Stats(); return st.Sent == 1 && st.InFlight == 0 })
+	if !strings.Contains(builder.String(), `Sender received ack.`) {
+		t.Errorf("sender did not log ack: %s", builder.String())
+	}
+	if st := sender.Stats(); st.Sent != 1 || st.InFlight != 0 {
+		t.Errorf("sender stats after ack: got %d sent, %d in flight, want 1, 0", st.Sent, st.InFlight)
 	}
 	sender.Stop()
-	// Ensure at least two loop iterations.
-	time.Sleep(2 * proxy.QuietLoopPause)
-	s := strings.Split(builder.String(), "\n")
-	l = len(s)
-	if l != 3 {
-		t.Errorf("sender did not log finishing. Expected %d lines, got %d: %v", 2, l-1, s)
+	if !strings.Contains(builder.String(), `Sender switching to Finishing mode`) {
+		t.Errorf("sender did not log finishing: %s", builder.String())
+	}
+}
+
+func TestSender_Stats(t *testing.T) {
+	var m sync.Mutex
+	fail := true
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if fail {
+			writer.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	s, _ := makeTestSender()
+	s.Client = *ts.Client()
+	s.LogEndpoint = ts.URL
+	s.WriteLog(proxy.ReportLog{})
+	<-s.Acks
+	m.Lock()
+	fail = false
+	m.Unlock()
+	s.WriteLogs([]proxy.ReportLog{{}, {}})
+	<-s.Acks
+
+	st := s.Stats()
+	if st.Sent != 2 || st.Failed != 1 || st.Lost != 1 {
+		t.Errorf("got %d sent, %d failed, %d lost, want 2, 1, 1", st.Sent, st.Failed, st.Lost)
+	}
+	if st.BytesSent == 0 {
+		t.Errorf("got no bytes sent")
+	}
+	if st.LastError == nil || st.LastErrorTime.IsZero() {
+		t.Errorf("got no last error")
+	}
+	if !st.LastSuccessTime.After(st.LastErrorTime) {
+		t.Errorf("last success %v is not after last error %v", st.LastSuccessTime, st.LastErrorTime)
 	}
 }
 
@@ -220,3 +259,303 @@ func TestSender_WriteLog(t *testing.T) {
 		})
 	}
 }
+
+func TestSender_StartBatching(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   uint
+		batchLinger time.Duration
+		sent        int
+		wantBatches []int
+	}{
+		{`unbatched`, 1, time.Hour, 3, []int{1, 1, 1}},
+		{`full batches`, 2, time.Hour, 4, []int{2, 2}},
+		{`linger`, 10, 10 * time.Millisecond, 3, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m sync.Mutex
+			var batches []int
+			ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				lr := proxy.LogReport{}
+				_ = json.NewDecoder(request.Body).Decode(&lr)
+				m.Lock()
+				defer m.Unlock()
+				batches = append(batches, len(lr.Logs))
+			}))
+			defer ts.Close()
+
+			s, _ := makeTestSender()
+			s.Client = *ts.Client()
+			s.LogEndpoint = ts.URL
+			s.BatchSize = tt.batchSize
+			s.BatchLinger = tt.batchLinger
+			go s.Start()
+			for i := 0; i < tt.sent; i++ {
+				s.Send(proxy.ReportLog{})
+			}
+			// Leave time for lingering batches to be sent before Stop flushes them.
+			time.Sleep(100 * time.Millisecond)
+			s.Stop()
+
+			m.Lock()
+			defer m.Unlock()
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf(`got batches %v, want %v`, batches, tt.wantBatches)
+			}
+			if sent := s.Stats().Sent; sent != uint64(tt.sent) {
+				t.Errorf(`got %d sent, want %d`, sent, tt.sent)
+			}
+		})
+	}
+}
+
+func TestSender_WriteLogsRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   uint
+		wantAttempts int
+		wantLevel    string
+	}{
+		{`happy after retries`, []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, 3, `trace`},
+		{`sad retries exhausted`, []int{http.StatusBadGateway, http.StatusBadGateway}, 1, 2, `warn`},
+		{`sad permanent failure`, []int{http.StatusUnauthorized, http.StatusOK}, 3, 1, `warn`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m sync.Mutex
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				m.Lock()
+				defer m.Unlock()
+				status := tt.statuses[attempts]
+				attempts++
+				if status == http.StatusTooManyRequests {
+					writer.Header().Set(proxy.RetryAfterHeader, `0`)
+				}
+				writer.WriteHeader(status)
+			}))
+			defer ts.Close()
+
+			s, cb := makeTestSender()
+			s.Client = *ts.Client()
+			s.LogEndpoint = ts.URL
+			s.MaxRetries = tt.maxRetries
+			s.RetryBaseDelay = time.Millisecond
+			s.RetryMaxDelay = 2 * time.Millisecond
+
+			s.WriteLogs([]proxy.ReportLog{{}, {}})
+			if n := <-s.Acks; n != 2 {
+				t.Errorf(`got ack for %d logs, want 2`, n)
+			}
+			m.Lock()
+			defer m.Unlock()
+			if attempts != tt.wantAttempts {
+				t.Errorf(`got %d attempts, want %d`, attempts, tt.wantAttempts)
+			}
+			lines := strings.Split(strings.TrimSpace(cb.String()), "\n")
+			log := struct{ Level string }{}
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &log); err != nil {
+				t.Fatalf(`unexpected log format: %v`, err)
+			}
+			if log.Level != tt.wantLevel {
+				t.Errorf(`got final log level %s, want %s`, log.Level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestSender_StartReportsFailuresAsLoss(t *testing.T) {
+	var m sync.Mutex
+	lost := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lr := proxy.LogReport{}
+		_ = json.NewDecoder(request.Body).Decode(&lr)
+		if lr.Logs[0].Type != proxy.Loss {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		defer m.Unlock()
+		n, _ := strconv.Atoi(lr.Logs[0].ErrorCode)
+		lost += n
+	}))
+	defer ts.Close()
+
+	s, _ := makeTestSender()
+	s.Client = *ts.Client()
+	s.LogEndpoint = ts.URL
+	s.BatchSize = 3
+	s.BatchLinger = time.Hour
+	go s.Start()
+	for i := 0; i < 3; i++ {
+		s.Send(proxy.ReportLog{Type: proxy.End})
+	}
+	s.Stop()
+
+	m.Lock()
+	defer m.Unlock()
+	if lost != 3 {
+		t.Errorf(`got %d reports lost, want %d`, lost, 3)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test if it does not hold
+// within a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(`condition not met in time`)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSender_SendDoesNotBlock(t *testing.T) {
+	s, _ := makeTestSender()
+	// The background sending loop is not started, so FanIn fills up.
+	for i := 0; i < proxy.FanInBacklog+3; i++ {
+		s.Send(proxy.ReportLog{})
+	}
+	if st := s.Stats(); st.Queued != proxy.FanInBacklog || st.Lost != 3 {
+		t.Errorf(`got %d queued, %d lost, want %d, 3`, st.Queued, st.Lost, proxy.FanInBacklog)
+	}
+}
+
+func TestSender_StartWorkers(t *testing.T) {
+	tests := []struct {
+		name        string
+		workers     uint
+		wantMaxBusy int32
+	}{
+		{`default to one worker`, 0, 1},
+		{`bounded workers`, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var busy, maxBusy int32
+			release := make(chan struct{})
+			ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				n := atomic.AddInt32(&busy, 1)
+				defer atomic.AddInt32(&busy, -1)
+				for {
+					max := atomic.LoadInt32(&maxBusy)
+					if n <= max || atomic.CompareAndSwapInt32(&maxBusy, max, n) {
+						break
+					}
+				}
+				<-release
+			}))
+			defer ts.Close()
+
+			s, _ := makeTestSender()
+			s.Client = *ts.Client()
+			s.LogEndpoint = ts.URL
+			s.Workers = tt.workers
+			go s.Start()
+			for i := 0; i < 10; i++ {
+				s.Send(proxy.ReportLog{})
+			}
+			waitFor(t, func() bool { return atomic.LoadInt32(&busy) == tt.wantMaxBusy })
+			// Leave time for extra transmissions to start, if any.
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			s.Stop()
+
+			if got := atomic.LoadInt32(&maxBusy); got != tt.wantMaxBusy {
+				t.Errorf(`got %d concurrent transmissions, want %d`, got, tt.wantMaxBusy)
+			}
+			if sent := s.Stats().Sent; sent != 10 {
+				t.Errorf(`got %d sent, want 10`, sent)
+			}
+		})
+	}
+}
+
+func TestSender_StartReportsSampling(t *testing.T) {
+	exporter := proxy.NewMemoryExporter()
+	s, _ := makeTestSender()
+	s.Exporter = exporter
+	s.SampleOut(`example.com`)
+	s.SampleOut(`example.com`)
+	s.SampleOut(`example.org`)
+	go s.Start()
+	s.Send(proxy.ReportLog{Type: proxy.End})
+	waitFor(t, func() bool { return len(exporter.Logs()) == 2 })
+	s.Stop()
+
+	rl := exporter.Logs()[1]
+	if rl.Type != proxy.Sampling {
+		t.Fatalf(`got report type %s, want %s`, rl.Type, proxy.Sampling)
+	}
+	if want := map[string]uint{`example.com`: 2, `example.org`: 1}; !reflect.DeepEqual(rl.SampledOut, want) {
+		t.Errorf(`got sampled out %v, want %v`, rl.SampledOut, want)
+	}
+	if st := s.Stats(); st.SampledOut != 3 {
+		t.Errorf(`got %d sampled out in stats, want 3`, st.SampledOut)
+	}
+}
+
+func TestSender_StartReportsSamplingWithoutTraffic(t *testing.T) {
+	tests := []struct {
+		name string
+		stop bool
+	}{
+		{`on linger`, false},
+		{`on finish`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := proxy.NewMemoryExporter()
+			s, _ := makeTestSender()
+			s.Exporter = exporter
+			s.BatchSize = 10
+			s.BatchLinger = 10 * time.Millisecond
+			if tt.stop {
+				s.BatchLinger = time.Hour
+			}
+			go s.Start()
+			s.SampleOut(`example.com`)
+			if !tt.stop {
+				waitFor(t, func() bool { return len(exporter.Logs()) == 1 })
+			}
+			s.Stop()
+
+			logs := exporter.Logs()
+			if len(logs) != 1 || logs[0].Type != proxy.Sampling {
+				t.Fatalf(`got reports %v, want a single sampling report`, logs)
+			}
+			if want := map[string]uint{`example.com`: 1}; !reflect.DeepEqual(logs[0].SampledOut, want) {
+				t.Errorf(`got sampled out %v, want %v`, logs[0].SampledOut, want)
+			}
+		})
+	}
+}
+
+func TestSender_StartReportsDiagnostics(t *testing.T) {
+	exporter := proxy.NewMemoryExporter()
+	s, _ := makeTestSender()
+	s.Exporter = exporter
+	failure := errors.New(`decoding failed`)
+	s.Diagnose(proxy.StageBodies, failure)
+	s.Diagnose(proxy.StageBodies, failure)
+	s.Diagnose(proxy.StageConnect, nil)
+	go s.Start()
+	s.Send(proxy.ReportLog{Type: proxy.End})
+	waitFor(t, func() bool { return len(exporter.Logs()) == 2 })
+	s.Stop()
+
+	rl := exporter.Logs()[1]
+	if rl.Type != proxy.Diagnostic {
+		t.Fatalf(`got report type %s, want %s`, rl.Type, proxy.Diagnostic)
+	}
+	if want := map[string]uint{`BodiesStage: decoding failed`: 2}; !reflect.DeepEqual(rl.Diagnostics, want) {
+		t.Errorf(`got diagnostics %v, want %v`, rl.Diagnostics, want)
+	}
+	if st := s.Stats(); st.Diagnostics != 2 || st.LastDiagnostic != failure {
+		t.Errorf(`got %d diagnostics in stats, last %v, want 2, last %v`, st.Diagnostics, st.LastDiagnostic, failure)
+	}
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transmissionError describes a failed LogReport transmission attempt.
+type transmissionError struct {
+	err error
+
+	// retryable is true if the same transmission may succeed later.
+	retryable bool
+
+	// retryAfter is the delay requested by the report server, if any.
+	retryAfter time.Duration
+
+	// statusCode is the HTTP status received, or 0 if no response was received.
+	statusCode int
+
+	// report is the body of the failed request, if a response was received.
+	report []byte
+
+	// responseBody is the body of the failed response, if any.
+	responseBody []byte
+}
+
+// Error implements the error interface.
+func (e *transmissionError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap supports errors.Is and errors.As.
+func (e *transmissionError) Unwrap() error {
+	return e.err
+}
+
+// Retryable implements the Retryable interface.
+func (e *transmissionError) Retryable() bool {
+	return e.retryable
+}
+
+// isRetryableStatus checks whether a response with the given status code may
+// be retried: timeouts, rate limiting, and server errors.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests ||
+		code >= http.StatusInternalServerError
+}
+
+// parseRetryAfter converts the value of a Retry-After header, in either of its
+// delay-seconds or HTTP-date forms, to a delay relative to now. It returns 0 if
+// the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == `` {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// retryDelay computes the delay before retry number attempt+1, using
+// exponential backoff with jitter, unless the report server requested a
+// specific delay. The result never exceeds RetryMaxDelay if it is set.
+func (s *Sender) retryDelay(attempt uint, retryAfter time.Duration) time.Duration {
+	delay := retryAfter
+	if delay <= 0 {
+		delay = s.RetryBaseDelay
+		for i := uint(0); i < attempt && delay > 0 && (s.RetryMaxDelay <= 0 || delay < s.RetryMaxDelay); i++ {
+			delay *= 2
+		}
+		if s.RetryMaxDelay > 0 && (delay > s.RetryMaxDelay || delay <= 0) {
+			delay = s.RetryMaxDelay
+		}
+		// "Equal jitter": keep half the delay, randomize the other half, to
+		// avoid synchronized retries from many agents after an outage.
+		if half := int64(delay / 2); half > 0 {
+			delay = time.Duration(half + rand.Int63n(half+1))
+		}
+	}
+	if s.RetryMaxDelay > 0 && delay > s.RetryMaxDelay {
+		delay = s.RetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_isRetryableStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		want bool
+	}{
+		{`bad request`, http.StatusBadRequest, false},
+		{`unauthorized`, http.StatusUnauthorized, false},
+		{`request timeout`, http.StatusRequestTimeout, true},
+		{`too many requests`, http.StatusTooManyRequests, true},
+		{`internal server error`, http.StatusInternalServerError, true},
+		{`service unavailable`, http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableStatus(tt.code); got != tt.want {
+				t.Errorf("isRetryableStatus(%d) = %t, want %t", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{`absent`, ``, 0},
+		{`seconds`, `120`, 2 * time.Minute},
+		{`negative seconds`, `-1`, 0},
+		{`date`, now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{`past date`, now.Add(-30 * time.Second).Format(http.TimeFormat), 0},
+		{`invalid`, `soon`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%s) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSender_retryDelay(t *testing.T) {
+	s := Sender{RetryBaseDelay: 100 * time.Millisecond, RetryMaxDelay: time.Second}
+	tests := []struct {
+		name       string
+		attempt    uint
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{`first`, 0, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{`third`, 2, 0, 200 * time.Millisecond, 400 * time.Millisecond},
+		{`capped`, 10, 0, 500 * time.Millisecond, time.Second},
+		{`overflow`, 100, 0, 500 * time.Millisecond, time.Second},
+		{`retry after`, 0, 700 * time.Millisecond, 700 * time.Millisecond, 700 * time.Millisecond},
+		{`retry after capped`, 0, time.Hour, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.retryDelay(tt.attempt, tt.retryAfter)
+			if got < tt.min || got > tt.max {
+				t.Errorf("retryDelay() = %v, want within [%v, %v]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
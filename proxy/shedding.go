@@ -0,0 +1,182 @@
+package proxy
+
+// ReportClass is the load shedding class of a ReportLog. When too many
+// ReportLog elements are in flight, the Sender sheds those with the lowest
+// class first.
+type ReportClass int
+
+const (
+	// ClassUnknown is the class of ReportLog elements lost without being
+	// inspected, like those evicted from a full Spool, and of loss and
+	// sampling reports.
+	ClassUnknown ReportClass = iota
+
+	// ClassDetected is the class of successful API calls reported at the
+	// DETECTED log level.
+	ClassDetected
+
+	// ClassDefault is the class of successful API calls reported at the
+	// RESTRICTED or ALL log levels without any triggered data collection rule.
+	ClassDefault
+
+	// ClassRule is the class of successful API calls which triggered data
+	// collection rules.
+	ClassRule
+
+	// ClassError is the class of failed API calls.
+	ClassError
+
+	// reportClasses is the number of report classes.
+	reportClasses
+)
+
+// detectedLogLevel is the ReportLog LogLevel of reports at the DETECTED level.
+const detectedLogLevel = `DETECTED`
+
+var reportClassNames = [reportClasses]string{
+	ClassUnknown:  `unknown`,
+	ClassDetected: `detected`,
+	ClassDefault:  `default`,
+	ClassRule:     `rule`,
+	ClassError:    `error`,
+}
+
+// String implements fmt.Stringer. The names are the keys of the ReportLog
+// Losses map.
+func (c ReportClass) String() string {
+	if c < 0 || c >= reportClasses {
+		return reportClassNames[ClassUnknown]
+	}
+	return reportClassNames[c]
+}
+
+// Classify returns the load shedding class of a ReportLog.
+func Classify(rl ReportLog) ReportClass {
+	switch {
+	case rl.Type == Loss, rl.Type == Sampling, rl.Type == Diagnostic:
+		return ClassUnknown
+	case rl.Type == Error:
+		return ClassError
+	case rl.ActiveDataCollectionRules != nil && len(*rl.ActiveDataCollectionRules) > 0:
+		return ClassRule
+	case rl.LogLevel == detectedLogLevel:
+		return ClassDetected
+	default:
+		return ClassDefault
+	}
+}
+
+// lossCounts is the number of ReportLog elements lost per ReportClass.
+type lossCounts [reportClasses]uint64
+
+// total returns the number of ReportLog elements lost across all classes.
+func (lc lossCounts) total() uint64 {
+	var n uint64
+	for _, c := range lc {
+		n += c
+	}
+	return n
+}
+
+// queuedReport locates a ReportLog of the pending or ready batches.
+type queuedReport struct {
+	// seq is the rank of the ReportLog in the order of the batches.
+	seq uint64
+	rl  *ReportLog
+}
+
+// shedIndex indexes by ReportClass the ReportLog elements of the pending and
+// ready batches, so that evict finds its victim without scanning the batches.
+// It is only accessed by the background sending loop.
+type shedIndex struct {
+	// queued holds the indexed ReportLog elements of each class, mostly in seq
+	// order. Those taken by a worker are dropped lazily.
+	queued [reportClasses][]queuedReport
+
+	// next is the seq of the next indexed ReportLog.
+	next uint64
+
+	// taken is the seq of the oldest ReportLog not yet taken by a worker.
+	taken uint64
+
+	// ends holds, for each ready batch, the seq following its last ReportLog.
+	ends []uint64
+}
+
+// add indexes a ReportLog appended to the pending batch. It must not move
+// until its batch is taken by a worker.
+func (x *shedIndex) add(rl *ReportLog) {
+	if class := Classify(*rl); class != ClassUnknown {
+		x.queued[class] = append(x.queued[class], queuedReport{seq: x.next, rl: rl})
+	}
+	x.next++
+}
+
+// ready records a batch made ready: the pending batch, or a summary batch,
+// which is not indexed.
+func (x *shedIndex) ready(pending bool) {
+	end := x.taken
+	switch {
+	case pending:
+		end = x.next
+	case len(x.ends) > 0:
+		end = x.ends[len(x.ends)-1]
+	}
+	x.ends = append(x.ends, end)
+}
+
+// take records the oldest ready batch as taken by a worker.
+func (x *shedIndex) take() {
+	x.taken, x.ends = x.ends[0], x.ends[1:]
+	for c, q := range x.queued {
+		for len(q) > 0 && q[0].seq < x.taken {
+			q = q[1:]
+		}
+		if len(q) == 0 {
+			q = nil
+		}
+		x.queued[c] = q
+	}
+}
+
+// evict makes room for a ReportLog of the given class when InFlightLimit is
+// reached, by replacing the most recent ReportLog of the lowest class below it
+// among the ones not yet taken by a worker. It returns the evicted ReportLog,
+// and false if no such ReportLog was found, in which case nothing was changed.
+func (s *Sender) evict(rl ReportLog) (ReportLog, bool) {
+	x := &s.shed
+	class := Classify(rl)
+	for c := ClassUnknown + 1; c < class; c++ {
+		q := x.queued[c]
+		for len(q) > 0 {
+			victim := q[len(q)-1]
+			q = q[:len(q)-1]
+			if victim.seq < x.taken {
+				continue
+			}
+			x.queued[c] = q
+			evicted := *victim.rl
+			*victim.rl = rl
+			x.queued[class] = append(x.queued[class], victim)
+			return evicted, true
+		}
+		x.queued[c] = q
+	}
+	return ReportLog{}, false
+}
+
+// byName returns the non-zero loss counts keyed by ReportClass name, or nil if
+// there are none.
+func (lc lossCounts) byName() map[string]uint {
+	var m map[string]uint
+	for c, n := range lc {
+		if n == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]uint)
+		}
+		m[ReportClass(c).String()] = uint(n)
+	}
+	return m
+}
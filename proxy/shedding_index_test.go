@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSender_evictIndex(t *testing.T) {
+	detected := ReportLog{LogLevel: detectedLogLevel}
+	normal := ReportLog{LogLevel: `RESTRICTED`}
+	failed := ReportLog{LogLevel: `RESTRICTED`, Type: Error}
+
+	s := &Sender{BatchSize: 2, BatchLinger: time.Hour}
+	queue := func(rl ReportLog) {
+		if s.pending == nil {
+			s.pending = make([]ReportLog, 0, s.batchCap())
+		}
+		s.pending = append(s.pending, rl)
+		s.shed.add(&s.pending[len(s.pending)-1])
+	}
+
+	// A batch taken by a worker holds no victim.
+	queue(detected)
+	queue(detected)
+	s.flush()
+	s.SampleOut(`example.com`)
+	s.reportSampling()
+	s.ready = s.ready[1:]
+	s.shed.take()
+	if len(s.ready) != 1 {
+		t.Fatalf(`got %d ready batches, want the sampling report`, len(s.ready))
+	}
+	queue(normal)
+	if _, ok := s.evict(normal); ok {
+		t.Fatal(`evicted a report of the same class`)
+	}
+
+	// The lowest class is evicted first, whether ready or pending.
+	queue(detected)
+	s.flush()
+	queue(normal)
+	for _, want := range []ReportClass{ClassDetected, ClassDefault, ClassDefault} {
+		evicted, ok := s.evict(failed)
+		if !ok {
+			t.Fatalf(`evicted nothing, want %v`, want)
+		}
+		if got := Classify(evicted); got != want {
+			t.Errorf(`evicted %v, want %v`, got, want)
+		}
+	}
+	if _, ok := s.evict(failed); ok {
+		t.Error(`evicted a report of the same class`)
+	}
+	for _, batch := range s.ready {
+		for _, rl := range batch {
+			if c := Classify(rl); c != ClassError && c != ClassUnknown {
+				t.Errorf(`got ready %v report, want only errors`, Classify(rl))
+			}
+		}
+	}
+	for _, rl := range s.pending {
+		if Classify(rl) != ClassError {
+			t.Errorf(`got pending %v report, want only errors`, Classify(rl))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package proxy_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+func TestClassify(t *testing.T) {
+	rules := []proxy.ReportDataCollectionRule{{Signature: `sig`}}
+	tests := []struct {
+		name string
+		rl   proxy.ReportLog
+		want proxy.ReportClass
+	}{
+		{`loss`, proxy.NewReportLossReport(1), proxy.ClassUnknown},
+		{`error`, proxy.ReportLog{LogLevel: `RESTRICTED`, Type: proxy.Error, ActiveDataCollectionRules: &rules}, proxy.ClassError},
+		{`rule`, proxy.ReportLog{LogLevel: `ALL`, Type: proxy.End, ActiveDataCollectionRules: &rules}, proxy.ClassRule},
+		{`no rule`, proxy.ReportLog{LogLevel: `RESTRICTED`, Type: proxy.End, ActiveDataCollectionRules: &[]proxy.ReportDataCollectionRule{}}, proxy.ClassDefault},
+		{`detected`, proxy.ReportLog{LogLevel: `DETECTED`}, proxy.ClassDetected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxy.Classify(tt.rl); got != tt.want {
+				t.Errorf(`Classify() = %v, want %v`, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSender_StartSheddingPriority(t *testing.T) {
+	detected := proxy.ReportLog{LogLevel: `DETECTED`}
+	failed := proxy.ReportLog{LogLevel: `RESTRICTED`, Type: proxy.Error}
+	exporter := proxy.NewMemoryExporter()
+
+	s, _ := makeTestSender()
+	s.Exporter = exporter
+	s.InFlightLimit = 2
+	s.BatchSize = 10
+	s.BatchLinger = time.Hour
+	go s.Start()
+	for _, rl := range []proxy.ReportLog{detected, detected, failed, detected, failed} {
+		s.Send(rl)
+	}
+	s.Stop()
+
+	var kept []proxy.ReportClass
+	var losses map[string]uint
+	for _, rl := range exporter.Logs() {
+		if rl.Type == proxy.Loss {
+			losses = rl.Losses
+			if rl.ErrorCode != `3` {
+				t.Errorf(`got loss code %s, want 3`, rl.ErrorCode)
+			}
+			continue
+		}
+		kept = append(kept, proxy.Classify(rl))
+	}
+	if want := []proxy.ReportClass{proxy.ClassError, proxy.ClassError}; !reflect.DeepEqual(kept, want) {
+		t.Errorf(`got kept classes %v, want %v`, kept, want)
+	}
+	if want := map[string]uint{`detected`: 3}; !reflect.DeepEqual(losses, want) {
+		t.Errorf(`got losses %v, want %v`, losses, want)
+	}
+}
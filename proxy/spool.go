@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultSpoolSegmentSize is the size in bytes beyond which a Spool starts
+	// writing to a new segment file.
+	DefaultSpoolSegmentSize = 1 << 20
+
+	// SpoolSegmentExtension is the file name extension of Spool segment files.
+	SpoolSegmentExtension = `.spool`
+)
+
+// spoolSegment describes a Spool segment file.
+type spoolSegment struct {
+	seq   uint64
+	size  int64
+	count uint
+}
+
+// Spool is a size-capped on-disk queue of ReportLog elements which could not
+// be transmitted, allowing them to be transmitted later, including after an
+// application restart.
+//
+// It stores ReportLog elements as JSON lines in segment files, named after
+// their sequence number. When the total size of the segments exceeds the
+// configured maximum, the oldest segments are dropped.
+//
+// It is safe for concurrent use.
+type Spool struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+
+	m sync.Mutex
+	// segments are the available segments, oldest first. The last one is the
+	// segment being written to, and file, if not nil, is open on it.
+	segments []spoolSegment
+	file     *os.File
+	nextSeq  uint64
+}
+
+// NewSpool builds a Spool storing its segments in dir, creating dir if needed,
+// and loading any segments left in it by a previous run.
+//
+// A maxBytes value of 0 means the Spool size is not capped. A segmentSize of 0
+// means DefaultSpoolSegmentSize.
+func NewSpool(dir string, maxBytes int64, segmentSize int64) (*Spool, error) {
+	if maxBytes < 0 || segmentSize < 0 {
+		return nil, fmt.Errorf("invalid spool sizes %d/%d", maxBytes, segmentSize)
+	}
+	if segmentSize == 0 {
+		segmentSize = DefaultSpoolSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+	sp := &Spool{dir: dir, maxBytes: maxBytes, segmentSize: segmentSize}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %w", err)
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, SpoolSegmentExtension) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, SpoolSegmentExtension), 16, 64)
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading spool segment %s: %w", name, err)
+		}
+		sp.segments = append(sp.segments, spoolSegment{
+			seq:   seq,
+			size:  info.Size(),
+			count: uint(bytes.Count(content, []byte{'\n'})),
+		})
+		if seq >= sp.nextSeq {
+			sp.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(sp.segments, func(i, j int) bool {
+		return sp.segments[i].seq < sp.segments[j].seq
+	})
+	return sp, nil
+}
+
+func (sp *Spool) path(seq uint64) string {
+	return filepath.Join(sp.dir, fmt.Sprintf("%016x%s", seq, SpoolSegmentExtension))
+}
+
+// Len returns the number of spooled ReportLog elements.
+func (sp *Spool) Len() uint {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+	var n uint
+	for _, seg := range sp.segments {
+		n += seg.count
+	}
+	return n
+}
+
+// Write appends ReportLog elements to the Spool. It returns the number of
+// previously spooled elements which were dropped to keep the Spool within its
+// maximum size.
+func (sp *Spool) Write(logs []ReportLog) (dropped uint, err error) {
+	if len(logs) == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rl := range logs {
+		// Cannot fail: ReportLog is made of basic JSON types.
+		_ = enc.Encode(rl)
+	}
+
+	sp.m.Lock()
+	defer sp.m.Unlock()
+
+	last := len(sp.segments) - 1
+	if last < 0 || sp.segments[last].size >= sp.segmentSize {
+		if err := sp.closeFile(); err != nil {
+			return 0, err
+		}
+		sp.segments = append(sp.segments, spoolSegment{seq: sp.nextSeq})
+		sp.nextSeq++
+		last++
+	}
+	seg := &sp.segments[last]
+	if sp.file == nil {
+		sp.file, err = os.OpenFile(sp.path(seg.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return 0, fmt.Errorf("opening spool segment: %w", err)
+		}
+	}
+	n, err := sp.file.Write(buf.Bytes())
+	seg.size += int64(n)
+	if err != nil {
+		return 0, fmt.Errorf("writing spool segment: %w", err)
+	}
+	seg.count += uint(len(logs))
+
+	return sp.enforceMaxBytes(), nil
+}
+
+// enforceMaxBytes drops the oldest segments, but not the one being written,
+// until the Spool fits its maximum size. It returns the number of ReportLog
+// elements dropped.
+func (sp *Spool) enforceMaxBytes() uint {
+	if sp.maxBytes == 0 {
+		return 0
+	}
+	var total int64
+	for _, seg := range sp.segments {
+		total += seg.size
+	}
+	var dropped uint
+	for total > sp.maxBytes && len(sp.segments) > 1 {
+		seg := sp.segments[0]
+		_ = os.Remove(sp.path(seg.seq))
+		sp.segments = sp.segments[1:]
+		total -= seg.size
+		dropped += seg.count
+	}
+	return dropped
+}
+
+// Take removes the oldest segment from the Spool and returns its ReportLog
+// elements, with a commit function to call once the caller is done with them.
+//
+// The commit function must be passed the number of elements actually handled:
+// if not all of them were, the remaining elements are put back at the head of
+// the Spool.
+//
+// If the Spool is empty, Take returns nil logs and commit.
+func (sp *Spool) Take() (logs []ReportLog, commit func(handled int) error, err error) {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+
+	if len(sp.segments) == 0 {
+		return nil, nil, nil
+	}
+	seg := sp.segments[0]
+	if len(sp.segments) == 1 {
+		if err := sp.closeFile(); err != nil {
+			return nil, nil, err
+		}
+	}
+	sp.segments = sp.segments[1:]
+
+	path := sp.path(seg.seq)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		sp.segments = append([]spoolSegment{seg}, sp.segments...)
+		return nil, nil, fmt.Errorf("reading spool segment: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, int(sp.segmentSize)+bufio.MaxScanTokenSize)
+	for scanner.Scan() {
+		rl := ReportLog{}
+		// Skip lines which may have been truncated by a crash.
+		if json.Unmarshal(scanner.Bytes(), &rl) == nil {
+			logs = append(logs, rl)
+		}
+	}
+
+	commit = func(handled int) error {
+		if handled >= len(logs) {
+			return os.Remove(path)
+		}
+		if handled < 0 {
+			handled = 0
+		}
+		remaining := logs[handled:]
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, rl := range remaining {
+			_ = enc.Encode(rl)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			return fmt.Errorf("rewriting spool segment: %w", err)
+		}
+		sp.m.Lock()
+		defer sp.m.Unlock()
+		seg.size = int64(buf.Len())
+		seg.count = uint(len(remaining))
+		sp.segments = append([]spoolSegment{seg}, sp.segments...)
+		return nil
+	}
+	return logs, commit, nil
+}
+
+// closeFile closes the open segment file, if any. It must be called with the
+// Spool lock held.
+func (sp *Spool) closeFile() error {
+	if sp.file == nil {
+		return nil
+	}
+	err := sp.file.Close()
+	sp.file = nil
+	return err
+}
+
+// Close closes the open segment file, if any. The Spool remains usable, and
+// will reopen files as needed.
+func (sp *Spool) Close() error {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+	return sp.closeFile()
+}
@@ -0,0 +1,167 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/bearer/go-agent/proxy"
+)
+
+func makeTestSpool(t *testing.T, maxBytes, segmentSize int64) (*proxy.Spool, string) {
+	dir, err := ioutil.TempDir(``, `bearer-spool`)
+	if err != nil {
+		t.Fatalf(`creating spool directory: %v`, err)
+	}
+	sp, err := proxy.NewSpool(dir, maxBytes, segmentSize)
+	if err != nil {
+		t.Fatalf(`creating spool: %v`, err)
+	}
+	return sp, dir
+}
+
+func makeTestLogs(n int) []proxy.ReportLog {
+	logs := make([]proxy.ReportLog, n)
+	for i := range logs {
+		logs[i] = proxy.ReportLog{StatusCode: i}
+	}
+	return logs
+}
+
+func TestNewSpool(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		segmentSize int64
+		wantErr     bool
+	}{
+		{`happy`, 0, 0, false},
+		{`sad negative max`, -1, 0, true},
+		{`sad negative segment`, 0, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := ioutil.TempDir(``, `bearer-spool`)
+			defer os.RemoveAll(dir)
+			_, err := proxy.NewSpool(dir, tt.maxBytes, tt.segmentSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf(`NewSpool() error = %v, wantErr %t`, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSpool_WriteTake(t *testing.T) {
+	// Tiny segments: every write uses a new segment.
+	sp, dir := makeTestSpool(t, 0, 1)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 3; i++ {
+		if _, err := sp.Write(makeTestLogs(2)); err != nil {
+			t.Fatalf(`Write() error: %v`, err)
+		}
+	}
+	if n := sp.Len(); n != 6 {
+		t.Errorf(`Len() = %d, want 6`, n)
+	}
+	_ = sp.Close()
+
+	// Reload from disk, as after an application restart.
+	sp, err := proxy.NewSpool(dir, 0, 1)
+	if err != nil {
+		t.Fatalf(`reloading spool: %v`, err)
+	}
+	if n := sp.Len(); n != 6 {
+		t.Errorf(`Len() after reload = %d, want 6`, n)
+	}
+
+	logs, commit, err := sp.Take()
+	if err != nil || len(logs) != 2 {
+		t.Fatalf(`Take() = %d logs, error %v, want 2 logs`, len(logs), err)
+	}
+	// Partial handling puts the rest back at the head of the spool.
+	if err := commit(1); err != nil {
+		t.Fatalf(`commit() error: %v`, err)
+	}
+	if n := sp.Len(); n != 5 {
+		t.Errorf(`Len() after partial commit = %d, want 5`, n)
+	}
+	logs, commit, _ = sp.Take()
+	if len(logs) != 1 || logs[0].StatusCode != 1 {
+		t.Fatalf(`Take() after partial commit = %v, want the uncommitted log`, logs)
+	}
+	_ = commit(len(logs))
+
+	for n := sp.Len(); n > 0; n = sp.Len() {
+		logs, commit, _ = sp.Take()
+		_ = commit(len(logs))
+	}
+	logs, commit, err = sp.Take()
+	if logs != nil || commit != nil || err != nil {
+		t.Errorf(`Take() on empty spool = %v, %v, want nil, nil`, logs, err)
+	}
+}
+
+func TestSpool_WriteMaxBytes(t *testing.T) {
+	sp, dir := makeTestSpool(t, 1, 1)
+	defer os.RemoveAll(dir)
+
+	dropped, _ := sp.Write(makeTestLogs(2))
+	if dropped != 0 {
+		t.Errorf(`first Write() dropped %d, want 0`, dropped)
+	}
+	dropped, _ = sp.Write(makeTestLogs(3))
+	if dropped != 2 {
+		t.Errorf(`second Write() dropped %d, want 2`, dropped)
+	}
+	if n := sp.Len(); n != 3 {
+		t.Errorf(`Len() = %d, want 3`, n)
+	}
+}
+
+func TestSender_Spool(t *testing.T) {
+	sp, dir := makeTestSpool(t, 0, 0)
+	defer os.RemoveAll(dir)
+
+	// Unreachable endpoint: transmissions are spooled, not lost.
+	s, _ := makeTestSender()
+	s.Spool = sp
+	s.LogEndpoint = `http://example.invalid`
+	s.WriteLogs(makeTestLogs(3))
+	<-s.Acks
+	if n := sp.Len(); n != 3 {
+		t.Fatalf(`spooled %d logs, want 3`, n)
+	}
+
+	// On start, the spooled logs are replayed.
+	var m sync.Mutex
+	received := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lr := proxy.LogReport{}
+		_ = json.NewDecoder(request.Body).Decode(&lr)
+		m.Lock()
+		defer m.Unlock()
+		received += len(lr.Logs)
+	}))
+	defer ts.Close()
+
+	s, _ = makeTestSender()
+	s.Spool = sp
+	s.Client = *ts.Client()
+	s.LogEndpoint = ts.URL
+	s.BatchSize = 2
+	go s.Start()
+	waitFor(t, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return received == 3
+	})
+	s.Stop()
+	if n := sp.Len(); n != 0 {
+		t.Errorf(`%d logs left in spool after replay, want 0`, n)
+	}
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the Sender activity.
+type Stats struct {
+	// Sent is the number of ReportLog elements successfully exported.
+	Sent uint64
+
+	// Failed is the number of ReportLog elements for which export was
+	// attempted and failed permanently.
+	Failed uint64
+
+	// Lost is the number of ReportLog elements which will never be exported:
+	// Failed ones, and those dropped because too many were in flight or
+	// evicted from a full Spool.
+	Lost uint64
+
+	// InFlight is the number of ReportLog elements accepted by the Sender and
+	// not yet acknowledged, whether batched or being exported.
+	InFlight uint64
+
+	// Queued is the number of ReportLog elements waiting to be accepted by the
+	// Sender.
+	Queued uint64
+
+	// Spooled is the number of ReportLog elements waiting in the Spool.
+	Spooled uint64
+
+	// SampledOut is the number of API calls sampled out instead of being
+	// reported.
+	SampledOut uint64
+
+	// Diagnostics is the number of internal agent errors, like listener
+	// failures, which were diverted from the API calls.
+	Diagnostics uint64
+
+	// LastDiagnostic is the last internal agent error, or nil if none happened.
+	LastDiagnostic error
+
+	// ListenerPanics is the number of panics recovered from the agent
+	// listeners. It is set by the agent, not by the Sender.
+	ListenerPanics uint64
+
+	// BytesSent is the size of the successfully exported payloads.
+	BytesSent uint64
+
+	// LastError is the last export error, or nil if none happened.
+	LastError error
+
+	// LastErrorTime is the time of the last export error.
+	LastErrorTime time.Time
+
+	// LastSuccessTime is the time of the last successful export.
+	LastSuccessTime time.Time
+}
+
+// senderStats records the Sender activity. It is safe for concurrent use, and
+// its zero value is ready to use.
+type senderStats struct {
+	m sync.Mutex
+	Stats
+
+	// unreported is the number of lost ReportLog elements per class not yet
+	// included in a loss report.
+	unreported lossCounts
+
+	// sampledOut is the number of API calls sampled out per host not yet
+	// included in a sampling report.
+	sampledOut map[string]uint
+
+	// diagnostics is the number of internal agent errors per stage and message
+	// not yet included in a diagnostic report.
+	diagnostics map[string]uint
+}
+
+const (
+	// maxDiagnosticKinds is the maximum number of distinct internal agent
+	// errors in a diagnostic report. Further ones are counted together.
+	maxDiagnosticKinds = 32
+	// otherDiagnostics is the diagnostic report key of the errors beyond
+	// maxDiagnosticKinds.
+	otherDiagnostics = `other`
+)
+
+// inFlight returns the number of ReportLog elements in flight.
+func (ss *senderStats) inFlight() uint64 {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	return ss.InFlight
+}
+
+// accept records n ReportLog elements entering flight.
+func (ss *senderStats) accept(n uint64) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.InFlight += n
+}
+
+// acknowledge records n ReportLog elements leaving flight, returning the
+// number actually in flight if it was less than n.
+func (ss *senderStats) acknowledge(n uint64) uint64 {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	if n > ss.InFlight {
+		n = ss.InFlight
+	}
+	ss.InFlight -= n
+	return n
+}
+
+// lose records n ReportLog elements of the given class lost without any
+// export attempt.
+func (ss *senderStats) lose(class ReportClass, n uint64) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.Lost += n
+	ss.unreported[class] += n
+}
+
+// fail records ReportLog elements lost after a failed export.
+func (ss *senderStats) fail(logs []ReportLog, err error) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	n := uint64(len(logs))
+	ss.Failed += n
+	ss.Lost += n
+	for _, rl := range logs {
+		ss.unreported[Classify(rl)]++
+	}
+	ss.setError(err)
+}
+
+// setError records an export error without any loss, as when retrying.
+func (ss *senderStats) setError(err error) {
+	if err == nil {
+		return
+	}
+	ss.LastError = err
+	ss.LastErrorTime = time.Now()
+}
+
+// recordError is the locking version of setError.
+func (ss *senderStats) recordError(err error) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.setError(err)
+}
+
+// succeed records n ReportLog elements successfully exported in a payload of
+// the given size.
+func (ss *senderStats) succeed(n uint64, bytes int) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.Sent += n
+	if bytes > 0 {
+		ss.BytesSent += uint64(bytes)
+	}
+	ss.LastSuccessTime = time.Now()
+}
+
+// takeUnreported returns the number of lost ReportLog elements per class since
+// its last call, for inclusion in a loss report.
+func (ss *senderStats) takeUnreported() lossCounts {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	lc := ss.unreported
+	ss.unreported = lossCounts{}
+	return lc
+}
+
+// snapshot returns a copy of the recorded Stats.
+func (ss *senderStats) snapshot() Stats {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	return ss.Stats
+}
+
+// sampleOut records an API call to host sampled out.
+func (ss *senderStats) sampleOut(host string) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.SampledOut++
+	if ss.sampledOut == nil {
+		ss.sampledOut = make(map[string]uint)
+	}
+	ss.sampledOut[host]++
+}
+
+// takeSampledOut returns the number of API calls sampled out per host since
+// its last call, for inclusion in a sampling report.
+func (ss *senderStats) takeSampledOut() map[string]uint {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	sampled := ss.sampledOut
+	ss.sampledOut = nil
+	return sampled
+}
+
+// diagnose records an internal agent error at an API call stage.
+func (ss *senderStats) diagnose(stage Stage, err error) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.Diagnostics++
+	ss.LastDiagnostic = err
+	if ss.diagnostics == nil {
+		ss.diagnostics = make(map[string]uint)
+	}
+	key := string(stage) + `: ` + err.Error()
+	if _, ok := ss.diagnostics[key]; !ok && len(ss.diagnostics) >= maxDiagnosticKinds {
+		key = otherDiagnostics
+	}
+	ss.diagnostics[key]++
+}
+
+// takeDiagnostics returns the number of internal agent errors per stage and
+// message since its last call, for inclusion in a diagnostic report.
+func (ss *senderStats) takeDiagnostics() map[string]uint {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	diagnostics := ss.diagnostics
+	ss.diagnostics = nil
+	return diagnostics
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// ReportTLS describes the TLS connection of an API call, and the certificate
+// presented by the peer: the server on outbound calls, the client, if any, on
+// inbound calls.
+type ReportTLS struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	// Protocol is the protocol negotiated with ALPN, if any, like h2.
+	Protocol string `json:"alpnProtocol,omitempty"`
+
+	CertificateSubject  string `json:"certificateSubject,omitempty"`
+	CertificateIssuer   string `json:"certificateIssuer,omitempty"`
+	CertificateNotAfter int64  `json:"certificateNotAfter,omitempty"` // Unix timestamp UTC milliseconds
+}
+
+// NewReportTLS builds the ReportTLS for a TLS connection state, or returns nil
+// if the connection did not use TLS.
+func NewReportTLS(state *tls.ConnectionState) *ReportTLS {
+	if state == nil {
+		return nil
+	}
+	rt := &ReportTLS{
+		Version:     TLSVersionName(state.Version),
+		CipherSuite: CipherSuiteName(state.CipherSuite),
+		Protocol:    state.NegotiatedProtocol,
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		rt.CertificateSubject = leaf.Subject.String()
+		rt.CertificateIssuer = leaf.Issuer.String()
+		rt.CertificateNotAfter = leaf.NotAfter.UnixNano() / 1e6
+	}
+	return rt
+}
+
+// TLSVersionName returns the name of a TLS version, like "TLS 1.3".
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionSSL30:
+		return `SSL 3.0`
+	case tls.VersionTLS10:
+		return `TLS 1.0`
+	case tls.VersionTLS11:
+		return `TLS 1.1`
+	case tls.VersionTLS12:
+		return `TLS 1.2`
+	case tls.VersionTLS13:
+		return `TLS 1.3`
+	default:
+		return fmt.Sprintf(`0x%04X`, version)
+	}
+}
+
+// cipherSuiteNames are the IANA names of the cipher suites supported by
+// crypto/tls.
+var cipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                `TLS_RSA_WITH_RC4_128_SHA`,
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           `TLS_RSA_WITH_3DES_EDE_CBC_SHA`,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            `TLS_RSA_WITH_AES_128_CBC_SHA`,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            `TLS_RSA_WITH_AES_256_CBC_SHA`,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         `TLS_RSA_WITH_AES_128_CBC_SHA256`,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         `TLS_RSA_WITH_AES_128_GCM_SHA256`,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         `TLS_RSA_WITH_AES_256_GCM_SHA384`,
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        `TLS_ECDHE_ECDSA_WITH_RC4_128_SHA`,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    `TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA`,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    `TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA`,
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          `TLS_ECDHE_RSA_WITH_RC4_128_SHA`,
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     `TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA`,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      `TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA`,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      `TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA`,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: `TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256`,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   `TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256`,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   `TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256`,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: `TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256`,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   `TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384`,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: `TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384`,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    `TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256`,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  `TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256`,
+	tls.TLS_AES_128_GCM_SHA256:                  `TLS_AES_128_GCM_SHA256`,
+	tls.TLS_AES_256_GCM_SHA384:                  `TLS_AES_256_GCM_SHA384`,
+	tls.TLS_CHACHA20_POLY1305_SHA256:            `TLS_CHACHA20_POLY1305_SHA256`,
+}
+
+// CipherSuiteName returns the IANA name of a cipher suite, or its hexadecimal
+// ID if it is unknown.
+func CipherSuiteName(id uint16) string {
+	if name, ok := cipherSuiteNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf(`0x%04X`, id)
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+)
+
+func TestNewReportTLS(t *testing.T) {
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	state := &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: `h2`,
+		PeerCertificates: []*x509.Certificate{{
+			Subject:  pkix.Name{CommonName: `api.example.com`, Organization: []string{`Example`}},
+			Issuer:   pkix.Name{CommonName: `Example CA`},
+			NotAfter: notAfter,
+		}},
+	}
+	want := ReportTLS{
+		Version:             `TLS 1.3`,
+		CipherSuite:         `TLS_AES_128_GCM_SHA256`,
+		Protocol:            `h2`,
+		CertificateSubject:  `CN=api.example.com,O=Example`,
+		CertificateIssuer:   `CN=Example CA`,
+		CertificateNotAfter: notAfter.Unix() * 1000,
+	}
+	if got := NewReportTLS(state); got == nil || *got != want {
+		t.Errorf(`NewReportTLS() = %+v, want %+v`, got, want)
+	}
+	if got := NewReportTLS(nil); got != nil {
+		t.Errorf(`NewReportTLS(nil) = %+v, want nil`, got)
+	}
+}
+
+func TestTLSNames(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{`version`, TLSVersionName(tls.VersionTLS12), `TLS 1.2`},
+		{`unknown version`, TLSVersionName(0x7f1c), `0x7F1C`},
+		{`cipher suite`, CipherSuiteName(tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305), `TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256`},
+		{`unknown cipher suite`, CipherSuiteName(0x00ff), `0x00FF`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf(`got %s, want %s`, tt.got, tt.want)
+			}
+		})
+	}
+}